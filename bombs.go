@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"time"
+)
+
+var bombKick = flag.Bool("bomb-kick", true, "players can kick bombs by walking into them")
+var bombSlideDelay = flag.Duration("bomb-slide-delay", 100*time.Millisecond, "time a kicked bomb takes to slide one tile")
+
+var errBombNotFound = errors.New("not-found")
+var errBombNotOwner = errors.New("not-owner")
+var errBombNotRemote = errors.New("not-remote")
+
+type BombDetonateInvalidMessage struct {
+	Type   string `json:"type"`
+	Id     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type BombMovedMessage struct {
+	Type          string `json:"type"`
+	Id            string `json:"id"`
+	X             int    `json:"x"`
+	Y             int    `json:"y"`
+	Direction     int    `json:"direction"`
+	MovementDelay int64  `json:"movementDelay"`
+	Moving        bool   `json:"moving"`
+	Player        string `json:"player"`
+}
+
+func createBombMovedMessage(bomb *Bomb, kicker *Player) BombMovedMessage {
+	playerID := ""
+
+	if kicker != nil {
+		playerID = kicker.Id
+	}
+
+	return BombMovedMessage{Type: "bomb-moved", Id: bomb.Id, X: bomb.X, Y: bomb.Y, Direction: bomb.Direction, MovementDelay: bomb.MovementDelay, Moving: bomb.Moving, Player: playerID}
+}
+
+// explodeBomb explode a bomba (e as bombas atingidas por ela) e envia a
+// nova previsão de perigo
+func (r *Room) explodeBomb(bomb *Bomb) {
+	if r.detonate(bomb) {
+		r.broadcastDangerZones()
+	}
+}
+
+// detonate remove a bomba, avisa a sala, mata os players atingidos e explode
+// em cadeia as bombas que estão no fogo
+func (r *Room) detonate(bomb *Bomb) bool {
+	if bomb = r.removeBomb(bomb); bomb == nil {
+		return false
+	}
+
+	logBombs.Debug("Bomb to be removed", "bomb", bomb.Id)
+
+	explosionPointList := r.blastPoints(bomb)
+
+	r.broadcast(createBombFiredMessage(bomb, explosionPointList))
+	r.destroyBlocks(bomb.Map, explosionPointList)
+
+	for _, p := range r.players() {
+		collidedWithPlayer := inPointList(p.X, p.Y, explosionPointList)
+
+		if collidedWithPlayer && p.Online && canDamage(bomb.Player, p) {
+			hitPlayer(p, bomb.Player)
+		}
+	}
+
+	for _, other := range r.bombs() {
+		if other.Map == bomb.Map && inPointList(other.X, other.Y, explosionPointList) {
+			r.detonate(other)
+		}
+	}
+
+	return true
+}
+
+// isDestructible retorna true para os blocos do mapa com a propriedade
+// "destructible" que ainda não foram alterados na rodada
+func (r *Room) isDestructible(mapName string, x, y int) bool {
+	r.tilesMU.Lock()
+	_, changed := r.Tiles[Point{X: x, Y: y}]
+	r.tilesMU.Unlock()
+
+	m := r.getMap(mapName)
+
+	if changed || x < 0 || y < 0 || x >= m.Meta.Width || y >= m.Meta.Height {
+		return false
+	}
+
+	gid := m.Meta.Data.Tiles[x+y*m.Meta.Width]
+
+	return gid > 0 && m.tileProperties(gid).getBool("destructible", false)
+}
+
+// destroyBlocks remove da rodada os blocos destrutíveis atingidos pela explosão
+func (r *Room) destroyBlocks(mapName string, points []*Point) {
+	tiles := make([]TileChange, 0)
+
+	for _, point := range points {
+		if r.isDestructible(mapName, point.X, point.Y) {
+			r.setTile(point.X, point.Y, 0)
+			tiles = append(tiles, TileChange{X: point.X, Y: point.Y, Tile: 0})
+		}
+	}
+
+	if len(tiles) > 0 {
+		r.broadcast(TilesChangedMessage{Type: "tiles-changed", Map: mapName, Tiles: tiles})
+	}
+}
+
+func (p *Player) createBombDetonateInvalidMessage(id string, err error) BombDetonateInvalidMessage {
+	return BombDetonateInvalidMessage{Type: "bomb-detonate-invalid", Id: id, Reason: err.Error()}
+}
+
+// detonateBomb explode a bomba remota do player: a indicada pelo id ou, sem
+// id, a mais antiga
+func (p *Player) detonateBomb(id string) error {
+	room := p.Room
+
+	if room == nil || p.Spectator || !room.Match.allowsPlay() {
+		return errBombNotFound
+	}
+
+	var target *Bomb
+
+	for _, bomb := range room.bombs() {
+		if id != "" && bomb.Id != id {
+			continue
+		}
+
+		if id == "" && (bomb.Player != p || !bomb.bombType().Remote) {
+			continue
+		}
+
+		if target == nil || bomb.CreatedAt < target.CreatedAt {
+			target = bomb
+		}
+	}
+
+	if target == nil {
+		return errBombNotFound
+	}
+
+	if target.Player != p {
+		return errBombNotOwner
+	}
+
+	if !target.bombType().Remote {
+		return errBombNotRemote
+	}
+
+	logBombs.Debug("Bomb detonated", "room", room.Code, "bomb", target.Id, "player", p.Id)
+
+	room.explodeBomb(target)
+
+	return nil
+}
+
+// bombAt retorna a bomba que está no tile (nil quando não há)
+func (r *Room) bombAt(mapName string, x, y int) *Bomb {
+	for _, bomb := range r.bombs() {
+		if bomb.Map == mapName && bomb.X == x && bomb.Y == y {
+			return bomb
+		}
+	}
+
+	return nil
+}
+
+// canBombMoveTo valida o próximo tile de uma bomba chutada: ela para em
+// blocos, em outras bombas e em players vivos
+func (r *Room) canBombMoveTo(bomb *Bomb, toX, toY int) bool {
+	if r.isBlocking(bomb.Map, toX, toY) {
+		return false
+	}
+
+	if r.bombAt(bomb.Map, toX, toY) != nil {
+		return false
+	}
+
+	for _, p := range r.players() {
+		if p.Online && p.Map == bomb.Map && p.X == toX && p.Y == toY {
+			return false
+		}
+	}
+
+	return true
+}
+
+// kickBomb chuta a bomba do tile à frente do player, que desliza na direção
+// do chute até encontrar um obstáculo
+func (p *Player) kickBomb(toX, toY, direction int) bool {
+	room := p.Room
+
+	if !p.CanKick || room == nil {
+		return false
+	}
+
+	if getCurrentTimestamp()-p.LastMovementTime <= p.MovementDelay {
+		return false
+	}
+
+	bomb := room.bombAt(p.Map, toX, toY)
+
+	if bomb == nil || bomb.Moving || !bomb.isSolid() {
+		return false
+	}
+
+	dx, dy, ok := directionOffset(direction)
+
+	if !ok || !room.canBombMoveTo(bomb, bomb.X+dx, bomb.Y+dy) {
+		return false
+	}
+
+	bomb = room.updateBomb(bomb.Id, func(b *Bomb) bool {
+		if b.Moving {
+			return false
+		}
+
+		b.Direction = direction
+		b.Moving = true
+		b.LastMovementTime = getCurrentTimestamp()
+
+		return true
+	})
+
+	if bomb == nil {
+		return false
+	}
+
+	p.updateLastMovementTime()
+	p.Direction = direction
+
+	logBombs.Debug("Bomb kicked", "room", room.Code, "bomb", bomb.Id, "player", p.Id, "direction", direction)
+
+	room.broadcast(createBombMovedMessage(bomb, p))
+
+	go room.slideBomb(bomb, p)
+
+	return true
+}
+
+// slideBomb move a bomba chutada um tile a cada MovementDelay até ela parar
+// ou explodir
+func (r *Room) slideBomb(bomb *Bomb, kicker *Player) {
+	// a bomba sempre termina parada, mesmo quando a rodada acaba no meio do chute
+	defer r.updateBomb(bomb.Id, func(b *Bomb) bool {
+		b.Moving = false
+		return true
+	})
+
+	for {
+		time.Sleep(time.Duration(bomb.MovementDelay) * time.Millisecond)
+
+		if !r.Match.allowsPlay() {
+			return
+		}
+
+		dx, dy, _ := directionOffset(bomb.Direction)
+		toX, toY := bomb.X+dx, bomb.Y+dy
+
+		if !r.canBombMoveTo(bomb, toX, toY) {
+			bomb = r.updateBomb(bomb.Id, func(b *Bomb) bool {
+				b.Moving = false
+				return true
+			})
+
+			if bomb != nil {
+				r.broadcast(createBombMovedMessage(bomb, kicker))
+			}
+
+			return
+		}
+
+		bomb = r.updateBomb(bomb.Id, func(b *Bomb) bool {
+			b.X = toX
+			b.Y = toY
+			b.LastMovementTime = getCurrentTimestamp()
+
+			return true
+		})
+
+		if bomb == nil {
+			return
+		}
+
+		r.broadcast(createBombMovedMessage(bomb, kicker))
+		r.broadcastDangerZones()
+	}
+}
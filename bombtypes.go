@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var unlockedBombTypes = flag.String("bomb-types", BombTypeNormal, "comma separated list of bomb types unlocked for the players")
+
+// tipos de bomba (o id é o bombType enviado aos clientes)
+const (
+	BombTypeNormal = "001"
+	BombTypePierce = "002"
+	BombTypeRemote = "003"
+	BombTypeMine   = "004"
+	BombTypeLine   = "005"
+)
+
+// formatos da explosão
+const (
+	BlastCross = "cross"
+	BlastLine  = "line"
+)
+
+// tipos liberados para os players (validados de -bomb-types na inicialização)
+var playerBombTypes = []string{BombTypeNormal}
+
+var errBombTypeNotFound = errors.New("bomb-type-not-found")
+var errBombTypeLocked = errors.New("bomb-type-locked")
+
+// BombType define o pavio, o formato da explosão e como a bomba interage com
+// o mapa e com os players
+type BombType struct {
+	Id         string
+	Name       string
+	FireDelay  int64  // pavio em ms
+	FireLength int    // alcance sem contar o tile da bomba
+	Blast      string // cross: as quatro direções; line: somente a direção da bomba
+	Pierce     bool   // a explosão atravessa os blocos
+	Remote     bool   // explode pelo comando do dono (o pavio é o limite)
+	Mine       bool   // explode quando alguém pisa nela depois de armada
+	ArmDelay   int64  // tempo para a mina armar em ms
+	Solid      bool   // bloqueia o movimento e pode ser chutada
+}
+
+var bombTypes = map[string]*BombType{
+	BombTypeNormal: {Id: BombTypeNormal, Name: "normal", FireDelay: 2000, FireLength: 3, Blast: BlastCross, Solid: true},
+	BombTypePierce: {Id: BombTypePierce, Name: "pierce", FireDelay: 2000, FireLength: 3, Blast: BlastCross, Pierce: true, Solid: true},
+	BombTypeRemote: {Id: BombTypeRemote, Name: "remote", FireDelay: 10000, FireLength: 3, Blast: BlastCross, Remote: true, Solid: true},
+	BombTypeMine:   {Id: BombTypeMine, Name: "mine", FireDelay: 30000, FireLength: 1, Blast: BlastCross, Mine: true, ArmDelay: 1000},
+	BombTypeLine:   {Id: BombTypeLine, Name: "line", FireDelay: 2500, FireLength: 6, Blast: BlastLine, Solid: true},
+}
+
+// getBombType aceita o id ou o nome do tipo
+func getBombType(name string) *BombType {
+	if bombType, ok := bombTypes[name]; ok {
+		return bombType
+	}
+
+	for _, bombType := range bombTypes {
+		if bombType.Name == name {
+			return bombType
+		}
+	}
+
+	return nil
+}
+
+// parseBombTypes valida a lista de tipos liberados configurada
+func parseBombTypes(list string) ([]string, error) {
+	ids := make([]string, 0)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		bombType := getBombType(name)
+
+		if bombType == nil {
+			return nil, fmt.Errorf("unknown bomb type %q", name)
+		}
+
+		ids = append(ids, bombType.Id)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("no bomb type unlocked")
+	}
+
+	return ids, nil
+}
+
+// selectBombType retorna o tipo pedido no bomb-add (vazio = o primeiro liberado)
+func (p *Player) selectBombType(name string) (*BombType, error) {
+	if name == "" && len(p.BombTypes) > 0 {
+		name = p.BombTypes[0]
+	}
+
+	bombType := getBombType(name)
+
+	if bombType == nil {
+		return nil, errBombTypeNotFound
+	}
+
+	for _, id := range p.BombTypes {
+		if id == bombType.Id {
+			return bombType, nil
+		}
+	}
+
+	return nil, errBombTypeLocked
+}
+
+func (b *Bomb) bombType() *BombType {
+	if bombType, ok := bombTypes[b.BombType]; ok {
+		return bombType
+	}
+
+	return bombTypes[BombTypeNormal]
+}
+
+func (b *Bomb) isSolid() bool {
+	return b.bombType().Solid
+}
+
+// blastPoints calcula os tiles atingidos pela explosão; sem pierce o fogo para
+// no primeiro bloco, atingindo o bloco quando ele é destrutível
+func (r *Room) blastPoints(b *Bomb) []*Point {
+	m := r.getMap(b.Map)
+	bombType := b.bombType()
+
+	points := []*Point{{X: b.X, Y: b.Y}}
+	directions := []int{DirectionUp, DirectionRight, DirectionDown, DirectionLeft}
+
+	if bombType.Blast == BlastLine {
+		directions = []int{b.Direction}
+	}
+
+	for _, direction := range directions {
+		dx, dy, ok := directionOffset(direction)
+
+		if !ok {
+			continue
+		}
+
+		for i := 1; i <= b.FireLength; i++ {
+			x, y := b.X+dx*i, b.Y+dy*i
+
+			if x < 0 || y < 0 || x >= m.Meta.Width || y >= m.Meta.Height {
+				break
+			}
+
+			if r.isBlocking(b.Map, x, y) {
+				if r.isDestructible(b.Map, x, y) {
+					points = append(points, &Point{X: x, Y: y})
+				}
+
+				if !bombType.Pierce {
+					break
+				}
+
+				continue
+			}
+
+			points = append(points, &Point{X: x, Y: y})
+		}
+	}
+
+	return points
+}
+
+// isTriggered retorna true quando a bomba deve explodir: pavio acabou ou,
+// para as minas armadas, alguém (que não o dono) pisou nela
+func (r *Room) isTriggered(bomb *Bomb) bool {
+	currentTime := getCurrentTimestamp()
+
+	if currentTime-bomb.CreatedAt > bomb.FireDelay {
+		return true
+	}
+
+	bombType := bomb.bombType()
+
+	if !bombType.Mine || currentTime-bomb.CreatedAt < bombType.ArmDelay {
+		return false
+	}
+
+	for _, p := range r.players() {
+		if p.Online && p.Map == bomb.Map && p.X == bomb.X && p.Y == bomb.Y && p != bomb.Player {
+			return true
+		}
+	}
+
+	return false
+}
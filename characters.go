@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var charactersFile = flag.String("characters", "characters.json", "character catalogue file")
+
+// personagem usado pelos players que não escolheram outro
+const defaultCharacter = "007"
+
+// habilidades especiais (além destas, o nome de um tipo de bomba libera o tipo)
+const (
+	AbilityKick      = "kick"
+	AbilityExtraLife = "extra-life"
+)
+
+var errCharacterNotFound = errors.New("not-found")
+var errCharacterInGame = errors.New("in-game")
+
+// Character define os atributos base de um personagem do catálogo
+type Character struct {
+	Id           string  `json:"id"`
+	Name         string  `json:"name"`
+	Speed        float64 `json:"speed"`        // tiles por segundo
+	BombCapacity int     `json:"bombCapacity"` // bombas ao mesmo tempo (0 = sem limite)
+	FireLength   int     `json:"fireLength"`   // alcance da bomba normal
+	Ability      string  `json:"ability"`
+	NPC          bool    `json:"npc,omitempty"` // usado somente pelos npcs
+}
+
+type CharacterListMessage struct {
+	Type       string      `json:"type"`
+	Characters []Character `json:"characters"`
+}
+
+type CharacterSelectedMessage struct {
+	Type string `json:"type"`
+	Character
+}
+
+type CharacterSelectInvalidMessage struct {
+	Type     string `json:"type"`
+	CharType string `json:"charType"`
+	Reason   string `json:"reason"`
+}
+
+var characters = []Character{
+	{Id: defaultCharacter, Name: "Classic", Speed: 5, BombCapacity: 3, FireLength: 3},
+	{Id: "003", Name: "Slime", Speed: 2, BombCapacity: 1, FireLength: 2, NPC: true},
+	{Id: "004", Name: "Ghost", Speed: 3, BombCapacity: 1, FireLength: 3, NPC: true},
+	{Id: "005", Name: "Golem", Speed: 4, BombCapacity: 2, FireLength: 3, NPC: true},
+}
+var charactersMU sync.RWMutex
+
+// com o catálogo carregado somente a habilidade kick permite chutar bombas
+var charactersLoaded bool
+
+// loadCharacters carrega e valida o catálogo; sem o arquivo ficam somente o
+// personagem padrão e os personagens dos npcs
+func loadCharacters(file string) error {
+	data, err := os.ReadFile(file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		logGame.Warn("Character catalogue not found, using the default character", "file", file)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	list := make([]Character, 0)
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid character catalogue: %w", err)
+	}
+
+	ids := make(map[string]bool)
+	npcs := 0
+
+	for _, c := range list {
+		if c.Id == "" || ids[c.Id] {
+			return fmt.Errorf("character %q: empty or duplicated id", c.Id)
+		}
+
+		if c.Speed <= 0 || c.BombCapacity < 0 || c.FireLength < 1 {
+			return fmt.Errorf("character %q: invalid speed, bomb capacity or fire length", c.Id)
+		}
+
+		if c.Ability != "" && c.Ability != AbilityKick && c.Ability != AbilityExtraLife && getBombType(c.Ability) == nil {
+			return fmt.Errorf("character %q: unknown ability %q", c.Id, c.Ability)
+		}
+
+		if c.NPC {
+			npcs++
+		}
+
+		ids[c.Id] = true
+	}
+
+	if !ids[defaultCharacter] {
+		return fmt.Errorf("default character %q not in catalogue", defaultCharacter)
+	}
+
+	if npcs == 0 {
+		return errors.New("no npc character in catalogue")
+	}
+
+	charactersMU.Lock()
+	characters = list
+	charactersLoaded = true
+	charactersMU.Unlock()
+
+	logGame.Info("Characters loaded", "file", file, "count", len(list))
+
+	return nil
+}
+
+// npcCharacters retorna os ids dos personagens dos npcs
+func npcCharacters() []string {
+	charactersMU.RLock()
+	defer charactersMU.RUnlock()
+
+	ids := make([]string, 0)
+
+	for _, c := range characters {
+		if c.NPC {
+			ids = append(ids, c.Id)
+		}
+	}
+
+	return ids
+}
+
+func getCharacter(id string) *Character {
+	charactersMU.RLock()
+	defer charactersMU.RUnlock()
+
+	for _, c := range characters {
+		if c.Id == id {
+			character := c
+			return &character
+		}
+	}
+
+	return nil
+}
+
+func catalogueLoaded() bool {
+	charactersMU.RLock()
+	defer charactersMU.RUnlock()
+
+	return charactersLoaded
+}
+
+func createCharacterListMessage() CharacterListMessage {
+	charactersMU.RLock()
+	defer charactersMU.RUnlock()
+
+	list := make([]Character, 0, len(characters))
+
+	for _, c := range characters {
+		if !c.NPC {
+			list = append(list, c)
+		}
+	}
+
+	return CharacterListMessage{Type: "character-list", Characters: list}
+}
+
+func (p *Player) createCharacterSelectInvalidMessage(charType string, err error) CharacterSelectInvalidMessage {
+	return CharacterSelectInvalidMessage{Type: "character-select-invalid", CharType: charType, Reason: err.Error()}
+}
+
+// selectCharacter troca o personagem do player fora do jogo (no lobby ou
+// aguardando a próxima rodada)
+func (p *Player) selectCharacter(charType string) error {
+	c := getCharacter(charType)
+
+	if c == nil || c.NPC {
+		return errCharacterNotFound
+	}
+
+	if p.Online {
+		return errCharacterInGame
+	}
+
+	p.CharType = c.Id
+	p.applyCharacter()
+
+	if err := p.send(CharacterSelectedMessage{Type: "character-selected", Character: *c}); err != nil {
+		logNet.Debug("Error on send command", "player", p.Id, "error", err)
+	}
+
+	if p.Room != nil && !p.Spectator {
+		p.Room.broadcastLobbyState()
+	}
+
+	return nil
+}
+
+// applyCharacter aplica ao player os atributos do personagem escolhido
+func (p *Player) applyCharacter() {
+	c := getCharacter(p.CharType)
+
+	if c == nil {
+		c = getCharacter(defaultCharacter)
+	}
+
+	p.CharType = c.Id
+	p.Speed = c.Speed
+	p.MovementDelay = int64(1000 / c.Speed)
+	p.BombCapacity = c.BombCapacity
+	p.FireLength = c.FireLength
+	p.Ability = c.Ability
+	p.CanKick = *bombKick && (c.Ability == AbilityKick || !catalogueLoaded())
+	p.BombTypes = append([]string{}, playerBombTypes...)
+
+	if bombType := getBombType(c.Ability); bombType != nil {
+		unlocked := false
+
+		for _, id := range p.BombTypes {
+			unlocked = unlocked || id == bombType.Id
+		}
+
+		if !unlocked {
+			p.BombTypes = append(p.BombTypes, bombType.Id)
+		}
+	}
+}
+
+// bombFireLength ajusta o alcance do tipo de bomba ao personagem: a diferença
+// entre o alcance do personagem e o da bomba normal vale para todos os tipos
+func (p *Player) bombFireLength(bombType *BombType) int {
+	if p.FireLength == 0 {
+		return bombType.FireLength
+	}
+
+	return max(bombType.FireLength+p.FireLength-bombTypes[BombTypeNormal].FireLength, 1)
+}
+
+// activeBombs retorna a quantidade de bombas do player na sala
+func (p *Player) activeBombs() int {
+	total := 0
+
+	if p.Room == nil {
+		return total
+	}
+
+	for _, bomb := range p.Room.bombs() {
+		if bomb.Player == p {
+			total++
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var continuousMovement = flag.Bool("continuous-movement", false, "move players continuously with sub-tile positions instead of one tile per move")
+var movementTick = flag.Duration("movement-tick", 50*time.Millisecond, "simulation step of the continuous movement")
+
+// posições em ponto fixo: cada tile tem tileUnits unidades
+const tileUnits = 1000
+
+type PlayerMotionMessage struct {
+	Type      string  `json:"type"`
+	Id        string  `json:"id"`
+	X         int     `json:"x"`
+	Y         int     `json:"y"`
+	PosX      int     `json:"posX"`
+	PosY      int     `json:"posY"`
+	Direction int     `json:"direction"`
+	Moving    bool    `json:"moving"`
+	Speed     float64 `json:"speed"`
+	Seq       int64   `json:"seq"`
+}
+
+func (p *Player) createPlayerMotionMessage() PlayerMotionMessage {
+	return PlayerMotionMessage{Type: "player-motion", Id: p.Id, X: p.X, Y: p.Y, PosX: p.PosX, PosY: p.PosY, Direction: p.Direction, Moving: p.MoveDirection != 0, Speed: p.Speed, Seq: p.LastMoveSeq}
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+
+	return a / b
+}
+
+func ceilDiv(a, b int) int {
+	return -floorDiv(-a, b)
+}
+
+// setTile coloca o player no tile, alinhando a posição em ponto fixo e
+// parando o movimento contínuo (spawn e troca de mapa)
+func (p *Player) setTile(x, y int) {
+	p.MoveDirection = 0
+	p.X = x
+	p.Y = y
+	p.PosX = x * tileUnits
+	p.PosY = y * tileUnits
+}
+
+// setPosition move o player em ponto fixo; o tile é o que contém o centro
+func (p *Player) setPosition(posX, posY int) {
+	p.PosX = posX
+	p.PosY = posY
+	p.X = floorDiv(posX+tileUnits/2, tileUnits)
+	p.Y = floorDiv(posY+tileUnits/2, tileUnits)
+}
+
+func boxesOverlap(ax, ay, bx, by int) bool {
+	return ax < bx+tileUnits && bx < ax+tileUnits && ay < by+tileUnits && by < ay+tileUnits
+}
+
+// collides retorna true quando a caixa do player (de um tile, com o canto em
+// x, y) encosta em um tile bloqueado ou em uma bomba; as bombas que o player
+// já está encostando são ignoradas para ele poder sair de cima delas
+func (r *Room) collides(p *Player, x, y int) bool {
+	for ty := floorDiv(y, tileUnits); ty <= floorDiv(y+tileUnits-1, tileUnits); ty++ {
+		for tx := floorDiv(x, tileUnits); tx <= floorDiv(x+tileUnits-1, tileUnits); tx++ {
+			if r.isBlocking(p.Map, tx, ty) {
+				return true
+			}
+		}
+	}
+
+	for _, bomb := range r.bombs() {
+		if bomb.Map != p.Map || !bomb.isSolid() {
+			continue
+		}
+
+		bombX := bomb.X * tileUnits
+		bombY := bomb.Y * tileUnits
+
+		if boxesOverlap(x, y, bombX, bombY) && !boxesOverlap(p.PosX, p.PosY, bombX, bombY) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// moveContinuous anda até distance unidades na direção do player, encostando
+// nos obstáculos e deslizando nos cantos dos pilares quando o player está
+// quase alinhado com a passagem
+func (r *Room) moveContinuous(p *Player, distance int) bool {
+	dx, dy, ok := directionOffset(p.MoveDirection)
+
+	if !ok || distance <= 0 {
+		return false
+	}
+
+	x, y := p.PosX+dx*distance, p.PosY+dy*distance
+
+	if !r.collides(p, x, y) {
+		p.setPosition(x, y)
+		return true
+	}
+
+	// encosta no obstáculo (os obstáculos são alinhados aos tiles)
+	if dx != 0 {
+		x = floorDiv(p.PosX, tileUnits) * tileUnits
+
+		if dx > 0 {
+			x = ceilDiv(p.PosX, tileUnits) * tileUnits
+		}
+
+		y = p.PosY
+	} else {
+		y = floorDiv(p.PosY, tileUnits) * tileUnits
+
+		if dy > 0 {
+			y = ceilDiv(p.PosY, tileUnits) * tileUnits
+		}
+
+		x = p.PosX
+	}
+
+	if (x != p.PosX || y != p.PosY) && !r.collides(p, x, y) {
+		p.setPosition(x, y)
+		return true
+	}
+
+	// desliza para a linha (ou coluna) mais próxima quando dela o caminho está livre
+	if dx != 0 {
+		row := floorDiv(p.PosY+tileUnits/2, tileUnits) * tileUnits
+		offset := row - p.PosY
+
+		if offset == 0 || r.collides(p, p.PosX+dx, row) {
+			return false
+		}
+
+		p.setPosition(p.PosX, p.PosY+clampDistance(offset, distance))
+	} else {
+		column := floorDiv(p.PosX+tileUnits/2, tileUnits) * tileUnits
+		offset := column - p.PosX
+
+		if offset == 0 || r.collides(p, column, p.PosY+dy) {
+			return false
+		}
+
+		p.setPosition(p.PosX+clampDistance(offset, distance), p.PosY)
+	}
+
+	return true
+}
+
+// clampDistance limita o deslocamento (com sinal) a distance unidades
+func clampDistance(offset, distance int) int {
+	if offset > distance {
+		return distance
+	} else if offset < -distance {
+		return -distance
+	}
+
+	return offset
+}
+
+// setMoveIntent guarda a direção mantida pelo player no modo contínuo
+// (0 para parar); o movimento é feito a cada passo da simulação
+func (p *Player) setMoveIntent(seq int64, direction int) {
+	if !p.acceptMoveSeq(seq) {
+		return
+	}
+
+	_, _, ok := directionOffset(direction)
+
+	if (!ok && direction != 0) || p.Room == nil || p.Spectator || !p.Room.Match.allowsPlay() {
+		toX, toY, _ := p.moveTarget(direction)
+
+		if err := p.send(p.createInvalidPositionMessage(toX, toY, direction)); err != nil {
+			logNet.Debug("Error on send command", "player", p.Id, "error", err)
+		}
+
+		return
+	}
+
+	p.MoveDirection = direction
+
+	if direction != 0 {
+		p.Direction = direction
+	}
+
+	p.Room.broadcast(p.createPlayerMotionMessage())
+}
+
+// simulateMovement executa um passo do movimento contínuo dos players da sala
+func (r *Room) simulateMovement(step time.Duration) {
+	if !r.Match.allowsPlay() {
+		return
+	}
+
+	for _, p := range r.humans() {
+		if !p.Online || p.MoveDirection == 0 {
+			continue
+		}
+
+		distance := int(p.Speed * tileUnits * step.Seconds())
+
+		if r.moveContinuous(p, distance) {
+			r.broadcast(p.createPlayerMotionMessage())
+		} else if toX, toY, ok := p.moveTarget(p.MoveDirection); ok {
+			// encostado em uma bomba: chuta
+			p.kickBomb(toX, toY, p.MoveDirection)
+		}
+	}
+}
+
+// runContinuousMovement executa a simulação do movimento contínuo de todas as salas
+func runContinuousMovement(step time.Duration) {
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !serverReady.Load() {
+			return
+		}
+
+		for _, room := range listRooms() {
+			room.simulateMovement(step)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+// newTestRoom cria uma sala com uma arena 7x7 sem blocos: paredes na borda e
+// pilares nos tiles pares (2,2), (2,4), (4,2) e (4,4)
+func newTestRoom(t *testing.T) *Room {
+	t.Helper()
+
+	_, m, err := buildGeneratedMap(MapGeneratorOptions{Seed: 1, Width: 7, Height: 7, Density: 0})
+
+	if err != nil {
+		t.Fatalf("cannot generate map: %v", err)
+	}
+
+	room := newRoom()
+	room.Maps["test"] = m
+
+	return room
+}
+
+func TestMoveContinuous(t *testing.T) {
+	tests := []struct {
+		name       string
+		posX, posY int
+		direction  int
+		distance   int
+		bomb       *Point
+		wantX      int
+		wantY      int
+		wantMoved  bool
+	}{
+		{name: "free path", posX: 1000, posY: 1000, direction: DirectionRight, distance: 300, wantX: 1300, wantY: 1000, wantMoved: true},
+		{name: "stop at the wall", posX: 1000, posY: 1000, direction: DirectionLeft, distance: 300, wantX: 1000, wantY: 1000},
+		{name: "touch the wall", posX: 1200, posY: 1000, direction: DirectionLeft, distance: 500, wantX: 1000, wantY: 1000, wantMoved: true},
+		{name: "stop at the pillar", posX: 2000, posY: 1000, direction: DirectionDown, distance: 300, wantX: 2000, wantY: 1000},
+		{name: "slide left around the pillar", posX: 1300, posY: 1000, direction: DirectionDown, distance: 100, wantX: 1200, wantY: 1000, wantMoved: true},
+		{name: "slide right around the pillar", posX: 2700, posY: 1000, direction: DirectionDown, distance: 100, wantX: 2800, wantY: 1000, wantMoved: true},
+		{name: "slide up to the row", posX: 1000, posY: 1400, direction: DirectionRight, distance: 500, wantX: 1000, wantY: 1000, wantMoved: true},
+		{name: "slide limited to the distance", posX: 1400, posY: 1000, direction: DirectionDown, distance: 100, wantX: 1300, wantY: 1000, wantMoved: true},
+		{name: "blocked by a bomb", posX: 1000, posY: 1000, direction: DirectionRight, distance: 300, bomb: &Point{X: 2, Y: 1}, wantX: 1000, wantY: 1000},
+		{name: "leave the bomb below", posX: 1000, posY: 1000, direction: DirectionRight, distance: 300, bomb: &Point{X: 1, Y: 1}, wantX: 1300, wantY: 1000, wantMoved: true},
+		{name: "no direction", posX: 1000, posY: 1000, distance: 300, wantX: 1000, wantY: 1000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t)
+			player := &Player{Id: "p1", Map: "test", Room: room, MoveDirection: test.direction}
+			player.setPosition(test.posX, test.posY)
+
+			if test.bomb != nil {
+				room.Bombs = append(room.Bombs, &Bomb{Id: "b1", X: test.bomb.X, Y: test.bomb.Y, Map: "test"})
+			}
+
+			moved := room.moveContinuous(player, test.distance)
+
+			if moved != test.wantMoved || player.PosX != test.wantX || player.PosY != test.wantY {
+				t.Errorf("moved %v to %d,%d, want %v to %d,%d", moved, player.PosX, player.PosY, test.wantMoved, test.wantX, test.wantY)
+			}
+
+			if player.X != floorDiv(player.PosX+tileUnits/2, tileUnits) || player.Y != floorDiv(player.PosY+tileUnits/2, tileUnits) {
+				t.Errorf("tile %d,%d does not match position %d,%d", player.X, player.Y, player.PosX, player.PosY)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+// DangerZone são os tiles que a bomba vai atingir e quando ela deve explodir,
+// considerando as reações em cadeia
+type DangerZone struct {
+	Bomb       string   `json:"bomb"`
+	Map        string   `json:"map"`
+	DetonateAt int64    `json:"detonateAt"`
+	Chained    bool     `json:"chained"`
+	Cells      []*Point `json:"cells"`
+}
+
+type DangerZonesMessage struct {
+	Type  string       `json:"type"`
+	Zones []DangerZone `json:"zones"`
+}
+
+// dangerZones prevê a explosão de todas as bombas da sala: cada bomba explode
+// no fim do seu pavio ou junto com a primeira bomba cuja explosão a atinge
+func (r *Room) dangerZones() []DangerZone {
+	bombs := r.bombs()
+	zones := make([]DangerZone, len(bombs))
+
+	for i, bomb := range bombs {
+		zones[i] = DangerZone{Bomb: bomb.Id, Map: bomb.Map, DetonateAt: bomb.CreatedAt + bomb.FireDelay, Cells: r.blastPoints(bomb)}
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		for i := range bombs {
+			for j, other := range bombs {
+				if i == j || other.Map != bombs[i].Map || zones[i].DetonateAt >= zones[j].DetonateAt {
+					continue
+				}
+
+				if inPointList(other.X, other.Y, zones[i].Cells) {
+					zones[j].DetonateAt = zones[i].DetonateAt
+					zones[j].Chained = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	return zones
+}
+
+func (r *Room) createDangerZonesMessage() DangerZonesMessage {
+	return DangerZonesMessage{Type: "danger-zones", Zones: r.dangerZones()}
+}
+
+// broadcastDangerZones envia a previsão atualizada sempre que as bombas ou os
+// tiles da sala mudam
+func (r *Room) broadcastDangerZones() {
+	r.broadcast(r.createDangerZonesMessage())
+}
+
+// announceBomb avisa a sala da bomba colocada e da nova previsão de perigo
+func (r *Room) announceBomb(bomb *Bomb) {
+	r.broadcast(createBombAddedMessage(bomb))
+	r.broadcastDangerZones()
+}
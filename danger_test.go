@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDangerZones(t *testing.T) {
+	type want struct {
+		detonateAt int64
+		chained    bool
+	}
+
+	tests := []struct {
+		name  string
+		bombs []*Bomb
+		want  []want
+	}{
+		{
+			name:  "single bomb",
+			bombs: []*Bomb{{Id: "a", X: 1, Y: 1, CreatedAt: 1000, FireDelay: 2000, FireLength: 2}},
+			want:  []want{{3000, false}},
+		},
+		{
+			name: "bomb in range goes off earlier",
+			bombs: []*Bomb{
+				{Id: "a", X: 1, Y: 1, CreatedAt: 1000, FireDelay: 2000, FireLength: 2},
+				{Id: "b", X: 3, Y: 1, CreatedAt: 0, FireDelay: 5000, FireLength: 1},
+			},
+			want: []want{{3000, false}, {3000, true}},
+		},
+		{
+			name: "later bomb is set off by the earlier one",
+			bombs: []*Bomb{
+				{Id: "a", X: 1, Y: 1, CreatedAt: 0, FireDelay: 5000, FireLength: 1},
+				{Id: "b", X: 3, Y: 1, CreatedAt: 1000, FireDelay: 2000, FireLength: 2},
+			},
+			want: []want{{3000, true}, {3000, false}},
+		},
+		{
+			name: "chain of three bombs",
+			bombs: []*Bomb{
+				{Id: "a", X: 1, Y: 1, CreatedAt: 0, FireDelay: 2000, FireLength: 2},
+				{Id: "b", X: 3, Y: 1, CreatedAt: 0, FireDelay: 9000, FireLength: 2},
+				{Id: "c", X: 5, Y: 1, CreatedAt: 0, FireDelay: 9000, FireLength: 1},
+			},
+			want: []want{{2000, false}, {2000, true}, {2000, true}},
+		},
+		{
+			name: "earliest of two chains",
+			bombs: []*Bomb{
+				{Id: "a", X: 1, Y: 1, CreatedAt: 0, FireDelay: 2000, FireLength: 2},
+				{Id: "b", X: 3, Y: 1, CreatedAt: 0, FireDelay: 4000, FireLength: 2},
+				{Id: "c", X: 5, Y: 3, CreatedAt: 0, FireDelay: 1000, FireLength: 2},
+				{Id: "d", X: 5, Y: 1, CreatedAt: 0, FireDelay: 9000, FireLength: 1},
+			},
+			want: []want{{2000, false}, {2000, true}, {1000, false}, {1000, true}},
+		},
+		{
+			name: "out of range",
+			bombs: []*Bomb{
+				{Id: "a", X: 1, Y: 1, CreatedAt: 0, FireDelay: 2000, FireLength: 2},
+				{Id: "b", X: 5, Y: 1, CreatedAt: 0, FireDelay: 5000, FireLength: 2},
+			},
+			want: []want{{2000, false}, {5000, false}},
+		},
+		{
+			name: "fire stops at the pillar",
+			bombs: []*Bomb{
+				{Id: "a", X: 2, Y: 1, CreatedAt: 0, FireDelay: 2000, FireLength: 3},
+				{Id: "b", X: 2, Y: 3, CreatedAt: 0, FireDelay: 5000, FireLength: 1},
+			},
+			want: []want{{2000, false}, {5000, false}},
+		},
+		{
+			name: "pierce goes through the pillar",
+			bombs: []*Bomb{
+				{Id: "a", X: 2, Y: 1, BombType: BombTypePierce, CreatedAt: 0, FireDelay: 2000, FireLength: 3},
+				{Id: "b", X: 2, Y: 3, CreatedAt: 0, FireDelay: 5000, FireLength: 1},
+			},
+			want: []want{{2000, false}, {2000, true}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t)
+
+			for _, bomb := range test.bombs {
+				bomb.Map = "test"
+				room.Bombs = append(room.Bombs, bomb)
+			}
+
+			zones := room.dangerZones()
+
+			if len(zones) != len(test.want) {
+				t.Fatalf("got %d zones, want %d", len(zones), len(test.want))
+			}
+
+			for i, zone := range zones {
+				if zone.Bomb != test.bombs[i].Id || zone.Map != "test" {
+					t.Errorf("zone %d: bomb %q on map %q", i, zone.Bomb, zone.Map)
+				}
+
+				if zone.DetonateAt != test.want[i].detonateAt || zone.Chained != test.want[i].chained {
+					t.Errorf("bomb %q: detonateAt %d chained %v, want %d chained %v", zone.Bomb, zone.DetonateAt, zone.Chained, test.want[i].detonateAt, test.want[i].chained)
+				}
+			}
+		})
+	}
+}
+
+func TestDangerZonesCells(t *testing.T) {
+	room := newTestRoom(t)
+	room.Bombs = append(room.Bombs, &Bomb{Id: "a", X: 1, Y: 1, Map: "test", CreatedAt: 0, FireDelay: 2000, FireLength: 2})
+
+	zones := room.dangerZones()
+
+	if len(zones) != 1 {
+		t.Fatalf("got %d zones, want 1", len(zones))
+	}
+
+	want := []Point{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 3, Y: 1}, {X: 1, Y: 2}, {X: 1, Y: 3}}
+
+	if len(zones[0].Cells) != len(want) {
+		t.Fatalf("cells = %v, want %v", zones[0].Cells, want)
+	}
+
+	for _, point := range want {
+		if !inPointList(point.X, point.Y, zones[0].Cells) {
+			t.Errorf("cell %d,%d not in the danger zone", point.X, point.Y)
+		}
+	}
+}
+
+func TestClearWorldClearsDangerZones(t *testing.T) {
+	room := newTestRoom(t)
+	room.Bombs = append(room.Bombs, &Bomb{Id: "a", X: 1, Y: 1, Map: "test", CreatedAt: 0, FireDelay: 2000, FireLength: 2})
+
+	room.clearWorld()
+
+	message := room.createDangerZonesMessage()
+
+	if message.Zones == nil || len(message.Zones) != 0 {
+		t.Errorf("zones = %v, want an empty list", message.Zones)
+	}
+}
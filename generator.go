@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// gids usados nos mapas gerados (tileset "meta" e "tileset1" do map0001)
+const (
+	metaGidWall  = 1
+	metaGidBlock = 2
+	floorGid     = 76
+	floorWallGid = 108
+)
+
+// tamanho máximo dos mapas gerados (largura e altura)
+const maxGeneratedMapSize = 99
+
+type MapGeneratorOptions struct {
+	Seed    int64
+	Width   int
+	Height  int
+	Density float64
+}
+
+// newGeneratorOptions retorna as opções padrão com uma seed nova
+func newGeneratorOptions() MapGeneratorOptions {
+	return MapGeneratorOptions{Seed: time.Now().UnixNano(), Width: 15, Height: 13, Density: 0.6}
+}
+
+func (options MapGeneratorOptions) validate() error {
+	if options.Width < 7 || options.Height < 7 || options.Width%2 == 0 || options.Height%2 == 0 {
+		return fmt.Errorf("invalid size %dx%d: width and height must be odd and at least 7", options.Width, options.Height)
+	}
+
+	if options.Width > maxGeneratedMapSize || options.Height > maxGeneratedMapSize {
+		return fmt.Errorf("invalid size %dx%d: width and height must be at most %d", options.Width, options.Height, maxGeneratedMapSize)
+	}
+
+	if options.Density < 0 || options.Density > 1 {
+		return fmt.Errorf("invalid density %v: must be between 0 and 1", options.Density)
+	}
+
+	return nil
+}
+
+func (options MapGeneratorOptions) mapName() string {
+	return fmt.Sprintf("generated-%d-%dx%d-%g", options.Seed, options.Width, options.Height, options.Density)
+}
+
+// generateMap cria uma arena clássica: paredes na borda, grade de pilares e
+// blocos destrutíveis sorteados, deixando livres os cantos de spawn
+func generateMap(options MapGeneratorOptions) (*Map, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	width := options.Width
+	height := options.Height
+
+	floor := make([]int, width*height)
+	meta := make([]int, width*height)
+
+	// cantos de spawn e os dois tiles vizinhos de cada um ficam livres
+	corners := []Point{{X: 1, Y: 1}, {X: width - 2, Y: 1}, {X: 1, Y: height - 2}, {X: width - 2, Y: height - 2}}
+	clear := make([]*Point, 0)
+
+	for _, corner := range corners {
+		dx, dy := 1, 1
+
+		if corner.X > 1 {
+			dx = -1
+		}
+
+		if corner.Y > 1 {
+			dy = -1
+		}
+
+		clear = append(clear, &Point{X: corner.X, Y: corner.Y}, &Point{X: corner.X + dx, Y: corner.Y}, &Point{X: corner.X, Y: corner.Y + dy})
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := x + y*width
+			border := x == 0 || y == 0 || x == width-1 || y == height-1
+			pillar := x%2 == 0 && y%2 == 0
+
+			floor[idx] = floorGid
+
+			if border || pillar {
+				floor[idx] = floorWallGid
+				meta[idx] = metaGidWall
+			} else if !inPointList(x, y, clear) && random.Float64() < options.Density {
+				meta[idx] = metaGidBlock
+			}
+		}
+	}
+
+	spawns := make([]MapObject, 0, len(corners))
+
+	for i, corner := range corners {
+		spawns = append(spawns, MapObject{
+			Id:      i + 1,
+			Type:    spawnObjectType,
+			X:       float64(corner.X * 32),
+			Y:       float64(corner.Y * 32),
+			Width:   32,
+			Height:  32,
+			Visible: true,
+		})
+	}
+
+	m := &Map{
+		Height:       height,
+		Nextlayerid:  4,
+		Nextobjectid: len(spawns) + 1,
+		Orientation:  "orthogonal",
+		Properties: MapProperties{
+			{Name: "generator", Type: "string", Value: "classic"},
+			{Name: "seed", Type: "string", Value: strconv.FormatInt(options.Seed, 10)},
+		},
+		Renderorder:  "right-down",
+		Tiledversion: "1.10.2",
+		Tileheight:   32,
+		Tilesets: []MapTileset{
+			{
+				Columns: 5, Firstgid: 1, Image: "../images/tilesets/meta.png", Imageheight: 32, Imagewidth: 160, Name: "meta", Tilecount: 5, Tileheight: 32, Tilewidth: 32,
+				Tiles: []MapTile{
+					{Id: metaGidWall - 1, Type: "wall"},
+					{Id: metaGidBlock - 1, Type: "block", Properties: MapProperties{{Name: "destructible", Type: "bool", Value: true}}},
+				},
+			},
+			{Columns: 32, Firstgid: 6, Image: "../images/tilesets/tileset1.png", Imageheight: 2016, Imagewidth: 1024, Name: "tileset1", Tilecount: 2016, Tileheight: 32, Tilewidth: 32},
+		},
+		Tilewidth: 32,
+		Type:      "map",
+		Version:   json.RawMessage(`"1.10"`),
+		Width:     width,
+		Layers: []MapLayer{
+			{Id: 1, Name: "Floor", Type: "tilelayer", Data: &MapLayerData{Tiles: floor}, Width: width, Height: height, Opacity: 1, Visible: true},
+			{Id: 2, Name: "Meta", Type: "tilelayer", Data: &MapLayerData{Tiles: meta}, Width: width, Height: height, Opacity: 0.5, Visible: true},
+			{Id: 3, Name: "Spawns", Type: "objectgroup", Draworder: "topdown", Objects: spawns, Opacity: 1, Visible: true},
+		},
+	}
+
+	return m, nil
+}
+
+// buildGeneratedMap gera um mapa em memória, sem gravar o arquivo
+func buildGeneratedMap(options MapGeneratorOptions) (string, *Map, error) {
+	generated, err := generateMap(options)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := json.Marshal(generated)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := options.mapName()
+	m, err := buildMap(name+".json", data)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, m, nil
+}
+
+// registerGeneratedMap gera um mapa em memória e o disponibiliza para todas
+// as salas
+func registerGeneratedMap(options MapGeneratorOptions) (string, *Map, error) {
+	name, m, err := buildGeneratedMap(options)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	setMap(name, m)
+
+	logMaps.Info("Map generated", "map", name, "seed", options.Seed, "width", options.Width, "height", options.Height)
+
+	return name, m, nil
+}
+
+// runGenerateCommand implementa o subcomando "generate", que grava o mapa
+// gerado como json do Tiled no diretório de mapas
+func runGenerateCommand(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	seed := flags.Int64("seed", time.Now().UnixNano(), "generator seed")
+	width := flags.Int("width", 15, "map width in tiles (odd)")
+	height := flags.Int("height", 13, "map height in tiles (odd)")
+	density := flags.Float64("density", 0.6, "chance of a destructible block on each free tile")
+	directory := flags.String("maps-dir", "maps", "directory to write the map file")
+	name := flags.String("name", "", "map name (default generated-<seed>-<width>x<height>-<density>)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	options := MapGeneratorOptions{Seed: *seed, Width: *width, Height: *height, Density: *density}
+	m, err := generateMap(options)
+
+	if err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = options.mapName()
+	}
+
+	data, err := json.MarshalIndent(m, "", " ")
+
+	if err != nil {
+		return err
+	}
+
+	mapFile := filepath.Join(*directory, *name+".json")
+
+	if err := os.WriteFile(mapFile, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Map written to %s (seed %d)\n", mapFile, *seed)
+
+	return nil
+}
+
+// roomMapOptions lê as opções do mapa pedido na criação da sala (seed, width,
+// height, density); retorna nil quando a mensagem não pede um mapa gerado
+func roomMapOptions(messageData map[string]interface{}) *MapGeneratorOptions {
+	options := newGeneratorOptions()
+	requested := false
+
+	if value, ok := messageData["seed"].(float64); ok {
+		options.Seed = int64(value)
+		requested = true
+	}
+
+	if value, ok := messageData["width"].(float64); ok {
+		options.Width = int(value)
+		requested = true
+	}
+
+	if value, ok := messageData["height"].(float64); ok {
+		options.Height = int(value)
+		requested = true
+	}
+
+	if value, ok := messageData["density"].(float64); ok {
+		options.Density = value
+		requested = true
+	}
+
+	if !requested {
+		return nil
+	}
+
+	return &options
+}
+
+// mapsGenerateHandler gera um mapa em memória (POST seed, width, height, density)
+func mapsGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	options := newGeneratorOptions()
+	var errs []error
+
+	if value := r.FormValue("seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		options.Seed = seed
+		errs = append(errs, err)
+	}
+
+	if value := r.FormValue("width"); value != "" {
+		width, err := strconv.Atoi(value)
+		options.Width = width
+		errs = append(errs, err)
+	}
+
+	if value := r.FormValue("height"); value != "" {
+		height, err := strconv.Atoi(value)
+		options.Height = height
+		errs = append(errs, err)
+	}
+
+	if value := r.FormValue("density"); value != "" {
+		density, err := strconv.ParseFloat(value, 64)
+		options.Density = density
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name, m, err := registerGeneratedMap(options)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"map": name, "hash": m.Hash, "seed": options.Seed})
+}
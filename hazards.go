@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	"github.com/pborman/uuid"
+)
+
+var hazardsEnabled = flag.Bool("hazards", true, "drop hazard bombs on the maps that enable them")
+
+// tipo dos objetos do Tiled que delimitam onde as bombas de perigo caem
+const hazardObjectType = "hazard"
+
+// HazardConfig é lida das propriedades do mapa:
+// hazards (bool), hazardInterval e hazardWarning (ms), hazardBombType,
+// hazardFireMin e hazardFireMax
+type HazardConfig struct {
+	Enabled  bool
+	Interval int64
+	Warning  int64
+	BombType string
+	FireMin  int
+	FireMax  int
+}
+
+// Hazard é uma bomba de perigo anunciada que ainda não caiu
+type Hazard struct {
+	Id         string
+	X          int
+	Y          int
+	Map        string
+	BombType   string
+	FireLength int
+	ImpactAt   int64
+}
+
+type HazardIncomingMessage struct {
+	Type       string `json:"type"`
+	Id         string `json:"id"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Map        string `json:"map"`
+	BombType   string `json:"bombType"`
+	FireLength int    `json:"fireLength"`
+	ImpactAt   int64  `json:"impactAt"`
+}
+
+func createHazardIncomingMessage(hazard *Hazard) HazardIncomingMessage {
+	return HazardIncomingMessage{Type: "hazard-incoming", Id: hazard.Id, X: hazard.X, Y: hazard.Y, Map: hazard.Map, BombType: hazard.BombType, FireLength: hazard.FireLength, ImpactAt: hazard.ImpactAt}
+}
+
+// parseHazardConfig lê e valida as propriedades de perigo do mapa (uma vez, na
+// carga do mapa)
+func (m *Map) parseHazardConfig() (HazardConfig, error) {
+	config := HazardConfig{
+		Enabled:  m.Properties.getBool("hazards", true),
+		Interval: int64(m.Properties.getInt("hazardInterval", 5000)),
+		Warning:  int64(m.Properties.getInt("hazardWarning", 1000)),
+		BombType: m.Properties.getString("hazardBombType", BombTypeNormal),
+		FireMin:  m.Properties.getInt("hazardFireMin", 1),
+		FireMax:  m.Properties.getInt("hazardFireMax", 8),
+	}
+
+	bombType := getBombType(config.BombType)
+
+	if bombType == nil {
+		return config, fmt.Errorf("unknown hazardBombType %q", config.BombType)
+	}
+
+	config.BombType = bombType.Id
+
+	if config.Interval < 0 || config.Warning < 0 {
+		return config, fmt.Errorf("invalid hazardInterval %d or hazardWarning %d", config.Interval, config.Warning)
+	}
+
+	if config.FireMin < 1 || config.FireMax < config.FireMin {
+		return config, fmt.Errorf("invalid hazardFireMin %d or hazardFireMax %d", config.FireMin, config.FireMax)
+	}
+
+	if config.Interval == 0 {
+		config.Enabled = false
+	}
+
+	return config, nil
+}
+
+// hazardZones retorna os tiles cobertos pelos objetos do tipo hazard ou, sem
+// objetos, todos os tiles do mapa
+func (m *Map) hazardZones() []Point {
+	points := make([]Point, 0)
+	objects := m.objectsOfType(hazardObjectType)
+
+	if len(objects) == 0 {
+		for y := 0; y < m.Meta.Height; y++ {
+			for x := 0; x < m.Meta.Width; x++ {
+				points = append(points, Point{X: x, Y: y})
+			}
+		}
+
+		return points
+	}
+
+	for _, object := range objects {
+		if object.Width == 0 || object.Height == 0 {
+			points = append(points, m.objectTile(object))
+			continue
+		}
+
+		fromX := int(math.Floor(object.X / float64(m.Tilewidth)))
+		fromY := int(math.Floor(object.Y / float64(m.Tileheight)))
+		toX := int(math.Ceil((object.X + object.Width) / float64(m.Tilewidth)))
+		toY := int(math.Ceil((object.Y + object.Height) / float64(m.Tileheight)))
+
+		for y := fromY; y < toY; y++ {
+			for x := fromX; x < toX; x++ {
+				points = append(points, Point{X: x, Y: y})
+			}
+		}
+	}
+
+	return points
+}
+
+// isHazardFree retorna true quando o tile pode receber uma bomba de perigo:
+// livre de blocos, de bombas e de outros perigos anunciados
+func (r *Room) isHazardFree(mapName string, x, y int) bool {
+	if r.isBlocking(mapName, x, y) || r.bombAt(mapName, x, y) != nil {
+		return false
+	}
+
+	r.hazardsMU.Lock()
+	defer r.hazardsMU.Unlock()
+
+	for _, hazard := range r.Hazards {
+		if hazard.Map == mapName && hazard.X == x && hazard.Y == y {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Room) resetHazards() {
+	r.hazardsMU.Lock()
+	defer r.hazardsMU.Unlock()
+
+	r.Hazards = make([]*Hazard, 0)
+	r.NextHazardAt = 0
+}
+
+// updateHazards anuncia uma bomba de perigo a cada intervalo do mapa e a
+// coloca no tile depois do aviso
+func (r *Room) updateHazards() {
+	if !*hazardsEnabled || !r.Match.allowsPlay() {
+		return
+	}
+
+	mapName := r.Rotation.currentMap()
+	m := r.getMap(mapName)
+	config := m.Hazards
+	currentTime := getCurrentTimestamp()
+
+	r.dropHazards(currentTime)
+
+	if !config.Enabled {
+		return
+	}
+
+	r.hazardsMU.Lock()
+	nextHazardAt := r.NextHazardAt
+
+	if nextHazardAt == 0 || currentTime >= nextHazardAt {
+		r.NextHazardAt = currentTime + config.Interval
+	}
+	r.hazardsMU.Unlock()
+
+	if nextHazardAt == 0 || currentTime < nextHazardAt {
+		return
+	}
+
+	candidates := make([]Point, 0)
+
+	for _, point := range m.hazardZones() {
+		if r.isHazardFree(mapName, point.X, point.Y) {
+			candidates = append(candidates, point)
+		}
+	}
+
+	if len(candidates) == 0 {
+		logBombs.Debug("No free tile for hazard", "room", r.Code, "map", mapName)
+		return
+	}
+
+	point := candidates[r.randomInt(0, len(candidates))]
+
+	hazard := &Hazard{
+		Id:         uuid.New(),
+		X:          point.X,
+		Y:          point.Y,
+		Map:        mapName,
+		BombType:   config.BombType,
+		FireLength: r.randomInt(config.FireMin, config.FireMax+1),
+		ImpactAt:   currentTime + config.Warning,
+	}
+
+	r.hazardsMU.Lock()
+	r.Hazards = append(r.Hazards, hazard)
+	r.hazardsMU.Unlock()
+
+	r.broadcast(createHazardIncomingMessage(hazard))
+}
+
+// dropHazards coloca as bombas de perigo cujo aviso terminou; um perigo cujo
+// tile foi ocupado por outra bomba é descartado
+func (r *Room) dropHazards(currentTime int64) {
+	r.hazardsMU.Lock()
+	due := make([]*Hazard, 0)
+	pending := make([]*Hazard, 0)
+
+	for _, hazard := range r.Hazards {
+		if currentTime >= hazard.ImpactAt {
+			due = append(due, hazard)
+		} else {
+			pending = append(pending, hazard)
+		}
+	}
+
+	r.Hazards = pending
+	r.hazardsMU.Unlock()
+
+	for _, hazard := range due {
+		if r.isBlocking(hazard.Map, hazard.X, hazard.Y) || r.bombAt(hazard.Map, hazard.X, hazard.Y) != nil {
+			logBombs.Debug("Hazard cancelled", "room", r.Code, "hazard", hazard.Id)
+			continue
+		}
+
+		bombType := getBombType(hazard.BombType)
+
+		bomb := &Bomb{
+			Id:               hazard.Id,
+			X:                hazard.X,
+			Y:                hazard.Y,
+			BombType:         bombType.Id,
+			Direction:        1,
+			MovementDelay:    bombSlideDelay.Milliseconds(),
+			LastMovementTime: currentTime,
+			CreatedAt:        currentTime,
+			FireDelay:        bombType.FireDelay,
+			FireLength:       hazard.FireLength,
+			Player:           nil,
+			Map:              hazard.Map,
+		}
+
+		r.addBomb(bomb)
+		r.announceBomb(bomb)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+var playerLives = flag.Int("player-lives", 1, "lives of the players in each round")
+var spawnShield = flag.Duration("spawn-shield", 2*time.Second, "invulnerability of the players when the round starts")
+var hitShield = flag.Duration("hit-shield", time.Second, "invulnerability of a player after losing a life")
+var shieldDuration = flag.Duration("shield-duration", 5*time.Second, "invulnerability given by the shield power-up")
+
+// tipo dos objetos do Tiled onde os power-ups de escudo aparecem
+const PowerUpShield = "shield"
+
+type PlayerHitMessage struct {
+	Type        string `json:"type"`
+	Id          string `json:"id"`
+	Attacker    string `json:"attacker"`
+	Lives       int    `json:"lives"`
+	ShieldUntil int64  `json:"shieldUntil"`
+}
+
+type PlayerStateMessage struct {
+	Type        string `json:"type"`
+	Id          string `json:"id"`
+	Lives       int    `json:"lives"`
+	ShieldUntil int64  `json:"shieldUntil"`
+}
+
+// PowerUp é um item no mapa que o player pega ao passar pelo tile
+type PowerUp struct {
+	Id   string `json:"id"`
+	Kind string `json:"kind"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Map  string `json:"map"`
+}
+
+type PowerUpAddedMessage struct {
+	Type string `json:"type"`
+	PowerUp
+}
+
+type PowerUpTakenMessage struct {
+	Type   string `json:"type"`
+	Id     string `json:"id"`
+	Kind   string `json:"kind"`
+	Player string `json:"player"`
+}
+
+func (p *Player) createPlayerHitMessage(attacker *Player) PlayerHitMessage {
+	attackerID := ""
+
+	if attacker != nil {
+		attackerID = attacker.Id
+	}
+
+	return PlayerHitMessage{Type: "player-hit", Id: p.Id, Attacker: attackerID, Lives: p.Lives, ShieldUntil: p.ShieldUntil}
+}
+
+func (p *Player) createPlayerStateMessage() PlayerStateMessage {
+	return PlayerStateMessage{Type: "player-state", Id: p.Id, Lives: p.Lives, ShieldUntil: p.ShieldUntil}
+}
+
+func (p *Player) isShielded() bool {
+	return getCurrentTimestamp() < p.ShieldUntil
+}
+
+// shield deixa o player invulnerável pelo tempo (somando ao escudo atual)
+func (p *Player) shield(duration time.Duration) {
+	p.ShieldUntil = max(p.ShieldUntil, getCurrentTimestamp()) + duration.Milliseconds()
+}
+
+// hitPlayer aplica uma explosão no player: com escudo nada acontece, senão ele
+// perde uma vida e fica invulnerável por um tempo ou morre sem vidas
+func hitPlayer(p *Player, attacker *Player) {
+	if p.isShielded() {
+		logGame.Debug("Player shielded", "player", p.Id, "shieldUntil", p.ShieldUntil)
+		return
+	}
+
+	p.Lives--
+
+	if p.Lives > 0 {
+		p.shield(*hitShield)
+	}
+
+	if p.Room != nil {
+		p.Room.broadcast(p.createPlayerHitMessage(attacker))
+	}
+
+	if p.Lives <= 0 {
+		killPlayer(p, attacker)
+	}
+}
+
+// resetLives devolve as vidas e dá o escudo de spawn aos players da rodada
+func (r *Room) resetLives() {
+	for _, p := range r.players() {
+		if p.NPC {
+			continue
+		}
+
+		p.Lives = *playerLives
+		p.ShieldUntil = 0
+
+		if p.Ability == AbilityExtraLife {
+			p.Lives++
+		}
+
+		if *spawnShield > 0 {
+			p.shield(*spawnShield)
+		}
+
+		r.broadcast(p.createPlayerStateMessage())
+	}
+}
+
+// placePowerUps coloca os power-ups definidos nos objetos do mapa
+func (r *Room) placePowerUps(mapName string) {
+	m := r.getMap(mapName)
+	powerUps := make([]*PowerUp, 0)
+
+	for _, object := range m.objectsOfType(PowerUpShield) {
+		point := m.objectTile(object)
+
+		if m.isBlocking(point.X, point.Y) {
+			logMaps.Warn("Ignoring blocked power-up", "object", object.Id, "x", point.X, "y", point.Y)
+			continue
+		}
+
+		powerUps = append(powerUps, &PowerUp{Id: uuid.New(), Kind: PowerUpShield, X: point.X, Y: point.Y, Map: mapName})
+	}
+
+	r.powerUpsMU.Lock()
+	r.PowerUps = powerUps
+	r.powerUpsMU.Unlock()
+
+	for _, powerUp := range powerUps {
+		r.broadcast(PowerUpAddedMessage{Type: "power-up-added", PowerUp: *powerUp})
+	}
+}
+
+func (r *Room) powerUps() []PowerUp {
+	r.powerUpsMU.Lock()
+	defer r.powerUpsMU.Unlock()
+
+	powerUps := make([]PowerUp, 0, len(r.PowerUps))
+
+	for _, powerUp := range r.PowerUps {
+		powerUps = append(powerUps, *powerUp)
+	}
+
+	return powerUps
+}
+
+// takePowerUp remove e retorna o power-up do tile (nil quando não há)
+func (r *Room) takePowerUp(mapName string, x, y int) *PowerUp {
+	r.powerUpsMU.Lock()
+	defer r.powerUpsMU.Unlock()
+
+	for i, powerUp := range r.PowerUps {
+		if powerUp.Map == mapName && powerUp.X == x && powerUp.Y == y {
+			r.PowerUps = append(r.PowerUps[:i], r.PowerUps[i+1:]...)
+			return powerUp
+		}
+	}
+
+	return nil
+}
+
+// updatePowerUps entrega os power-ups aos players vivos que estão no tile
+func (r *Room) updatePowerUps() {
+	if !r.Match.allowsPlay() {
+		return
+	}
+
+	for _, p := range r.humans() {
+		if !p.Online {
+			continue
+		}
+
+		powerUp := r.takePowerUp(p.Map, p.X, p.Y)
+
+		if powerUp == nil {
+			continue
+		}
+
+		p.shield(*shieldDuration)
+
+		logGame.Debug("Power-up taken", "room", r.Code, "player", p.Id, "kind", powerUp.Kind)
+
+		r.broadcast(PowerUpTakenMessage{Type: "power-up-taken", Id: powerUp.Id, Kind: powerUp.Kind, Player: p.Id})
+		r.broadcast(p.createPlayerStateMessage())
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// níveis de log por subsistema, alteráveis em tempo de execução
+var logLevels = map[string]*slog.LevelVar{
+	"net":   new(slog.LevelVar),
+	"game":  new(slog.LevelVar),
+	"maps":  new(slog.LevelVar),
+	"bombs": new(slog.LevelVar),
+	"npc":   new(slog.LevelVar),
+	"http":  new(slog.LevelVar),
+}
+
+var (
+	logNet   = slog.Default()
+	logGame  = slog.Default()
+	logMaps  = slog.Default()
+	logBombs = slog.Default()
+	logNPC   = slog.Default()
+	logHTTP  = slog.Default()
+)
+
+// subsystemHandler filtra os registros pelo nível do subsistema antes de
+// repassar para o handler de saída compartilhado
+type subsystemHandler struct {
+	slog.Handler
+	level *slog.LevelVar
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &subsystemHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return &subsystemHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return level, fmt.Errorf("invalid log level %q", value)
+	}
+
+	return level, nil
+}
+
+// setupLogging configura a saída (text ou json), o nível padrão e os níveis
+// específicos no formato "net=debug,maps=warn"
+func setupLogging(format, defaultLevel, subsystemLevels string) error {
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var output slog.Handler
+
+	switch format {
+	case "text":
+		output = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		output = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	level, err := parseLogLevel(defaultLevel)
+
+	if err != nil {
+		return err
+	}
+
+	for _, levelVar := range logLevels {
+		levelVar.Set(level)
+	}
+
+	if subsystemLevels != "" {
+		for _, item := range strings.Split(subsystemLevels, ",") {
+			name, value, found := strings.Cut(item, "=")
+
+			if !found {
+				return fmt.Errorf("invalid subsystem log level %q", item)
+			}
+
+			if err := setLogLevel(strings.TrimSpace(name), value); err != nil {
+				return err
+			}
+		}
+	}
+
+	newLogger := func(subsystem string) *slog.Logger {
+		handler := &subsystemHandler{Handler: output, level: logLevels[subsystem]}
+		return slog.New(handler).With("subsystem", subsystem)
+	}
+
+	logNet = newLogger("net")
+	logGame = newLogger("game")
+	logMaps = newLogger("maps")
+	logBombs = newLogger("bombs")
+	logNPC = newLogger("npc")
+	logHTTP = newLogger("http")
+
+	return nil
+}
+
+func setLogLevel(subsystem, value string) error {
+	levelVar, ok := logLevels[subsystem]
+
+	if !ok {
+		return fmt.Errorf("unknown log subsystem %q", subsystem)
+	}
+
+	level, err := parseLogLevel(value)
+
+	if err != nil {
+		return err
+	}
+
+	levelVar.Set(level)
+
+	return nil
+}
+
+// logLevelHandler lista (GET) ou altera (POST subsystem=net&level=debug) os
+// níveis de log em tempo de execução
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		subsystem := r.FormValue("subsystem")
+		level := r.FormValue("level")
+
+		if err := setLogLevel(subsystem, level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logHTTP.Info("Log level changed", "target", subsystem, "level", level)
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	levels := make(map[string]string)
+
+	for name, levelVar := range logLevels {
+		levels[name] = levelVar.Level().String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(levels)
+}
@@ -2,29 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/pborman/uuid"
 	"golang.org/x/net/websocket"
-	"io/ioutil"
-	"log"
 	"math"
-	"math/rand"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 var appVersion = "1.0.27"
-var maps = make(map[string]*Map)
-var tickerBombs = time.NewTicker(time.Millisecond * 500)
+var tickerBombs = time.NewTicker(time.Millisecond * 100)
 var playersMU sync.Mutex
-var bombsMU sync.Mutex
 var maxQuantityOfNPCs = 10
-var tickerAddBombs = time.NewTicker(time.Millisecond * 5000)
+var tickerHazards = time.NewTicker(time.Millisecond * 250)
 var tickerAddNPC = time.NewTicker(time.Millisecond * 5000)
-var debugLogEnabled = false
+var listenAddress = flag.String("listen", ":3030", "http listen address")
+var shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "max time to disconnect players on shutdown")
+var reconnectAfter = flag.Duration("reconnect-after", 5*time.Second, "reconnect hint sent to clients on shutdown")
+var adminToken = flag.String("admin-token", "", "bearer token required by the /admin endpoints (empty disables them)")
+var logFormat = flag.String("log-format", "text", "log output format: text or json")
+var logLevel = flag.String("log-level", "info", "default log level: debug, info, warn or error")
+var logSubsystemLevels = flag.String("log-levels", "", "per-subsystem log levels, e.g. net=debug,maps=warn")
 
 /*
 var validateOrigin = false
@@ -44,43 +48,8 @@ var wsUpgrader = websocket.Upgrader{
 }
 */
 
+// todos os players logados, estejam ou não em uma sala
 var Players = make([]*Player, 0)
-var Bombs = make([]*Bomb, 0)
-
-type Map struct {
-	Height int `json:"height"`
-	Layers []struct {
-		Data    []int  `json:"data"`
-		Height  int    `json:"height"`
-		Name    string `json:"name"`
-		Opacity int    `json:"opacity"`
-		Type    string `json:"type"`
-		Visible bool   `json:"visible"`
-		Width   int    `json:"width"`
-		X       int    `json:"x"`
-		Y       int    `json:"y"`
-	} `json:"layers"`
-	Nextobjectid int    `json:"nextobjectid"`
-	Orientation  string `json:"orientation"`
-	Renderorder  string `json:"renderorder"`
-	Tileheight   int    `json:"tileheight"`
-	Tilesets     []struct {
-		Columns     int    `json:"columns"`
-		Firstgid    int    `json:"firstgid"`
-		Image       string `json:"image"`
-		Imageheight int    `json:"imageheight"`
-		Imagewidth  int    `json:"imagewidth"`
-		Margin      int    `json:"margin"`
-		Name        string `json:"name"`
-		Spacing     int    `json:"spacing"`
-		Tilecount   int    `json:"tilecount"`
-		Tileheight  int    `json:"tileheight"`
-		Tilewidth   int    `json:"tilewidth"`
-	} `json:"tilesets"`
-	Tilewidth int `json:"tilewidth"`
-	Version   int `json:"version"`
-	Width     int `json:"width"`
-}
 
 type SimpleMessage struct {
 	Type string `json:"type"`
@@ -105,6 +74,7 @@ type PlayerMoveOkMessage struct {
 	X         int    `json:"x"`
 	Y         int    `json:"y"`
 	Direction int    `json:"direction"`
+	Seq       int64  `json:"seq"`
 }
 
 type PlayerRemovedMessage struct {
@@ -121,18 +91,31 @@ type PlayerInvalidPositionMessage struct {
 	ToX         int    `json:"toX"`
 	ToY         int    `json:"toY"`
 	ToDirection int    `json:"toDirection"`
+	Seq         int64  `json:"seq"`
 }
 
 type PlayerDataMessage struct {
-	Type          string `json:"type"`
-	Id            string `json:"id"`
-	X             int    `json:"x"`
-	Y             int    `json:"y"`
-	CharType      string `json:"charType"`
-	Direction     int    `json:"direction"`
-	MovementDelay int64  `json:"movementDelay"`
-	Map           string `json:"map"`
-	AddBombDelay  int64  `json:"addBombDelay"`
+	Type          string   `json:"type"`
+	Id            string   `json:"id"`
+	X             int      `json:"x"`
+	Y             int      `json:"y"`
+	CharType      string   `json:"charType"`
+	Direction     int      `json:"direction"`
+	MovementDelay int64    `json:"movementDelay"`
+	Map           string   `json:"map"`
+	MapHash       string   `json:"mapHash"`
+	Team          int      `json:"team"`
+	AddBombDelay  int64    `json:"addBombDelay"`
+	PosX          int      `json:"posX"`
+	PosY          int      `json:"posY"`
+	Speed         float64  `json:"speed"`
+	CanKick       bool     `json:"canKick"`
+	BombTypes     []string `json:"bombTypes"`
+	Lives         int      `json:"lives"`
+	ShieldUntil   int64    `json:"shieldUntil"`
+	BombCapacity  int      `json:"bombCapacity"`
+	FireLength    int      `json:"fireLength"`
+	Ability       string   `json:"ability"`
 }
 
 type BombAddedMessage struct {
@@ -147,25 +130,29 @@ type BombAddedMessage struct {
 	FireDelay     int64  `json:"fireDelay"`
 	FireLength    int    `json:"fireLength"`
 	Player        string `json:"player"`
+	Moving        bool   `json:"moving"`
 }
 
 type BombAddInvalidMessage struct {
-	Type string `json:"type"`
-	X    int    `json:"x"`
-	Y    int    `json:"y"`
-	ToX  int    `json:"toX"`
-	ToY  int    `json:"toY"`
+	Type     string `json:"type"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	ToX      int    `json:"toX"`
+	ToY      int    `json:"toY"`
+	BombType string `json:"bombType"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type BombFiredMessage struct {
-	Type       string `json:"type"`
-	Id         string `json:"id"`
-	X          int    `json:"x"`
-	Y          int    `json:"y"`
-	BombType   string `json:"bombType"`
-	Direction  int    `json:"direction"`
-	FireLength int    `json:"fireLength"`
-	Player     string `json:"player"`
+	Type       string   `json:"type"`
+	Id         string   `json:"id"`
+	X          int      `json:"x"`
+	Y          int      `json:"y"`
+	BombType   string   `json:"bombType"`
+	Direction  int      `json:"direction"`
+	FireLength int      `json:"fireLength"`
+	Player     string   `json:"player"`
+	Cells      []*Point `json:"cells"`
 }
 
 type Player struct {
@@ -176,12 +163,30 @@ type Player struct {
 	Direction        int
 	MovementDelay    int64
 	LastMovementTime int64
+	LastMoveSeq      int64
+	PosX             int
+	PosY             int
+	MoveDirection    int
+	Speed            float64
+	CanKick          bool
+	BombTypes        []string
+	Lives            int
+	ShieldUntil      int64
+	BombCapacity     int
+	FireLength       int
+	Ability          string
 	LastPingTime     int64
 	Map              string
 	LastAddBombTime  int64
 	AddBombDelay     int64
 	NPC              bool
 	Online           bool
+	Kills            int
+	Team             int
+	Room             *Room
+	Spectator        bool
+	Following        string
+	Replay           *ReplayPlayback
 
 	Socket *websocket.Conn
 	mu     sync.Mutex
@@ -199,23 +204,13 @@ type Bomb struct {
 	FireLength       int
 	FireDelay        int64
 	Player           *Player
+	Map              string
+	Moving           bool
 }
 
 type Point struct {
-	X int
-	Y int
-}
-
-func debug(message string) {
-	if debugLogEnabled {
-		log.Printf("> %s\n", message)
-	}
-}
-
-func debugf(format string, params ...interface{}) {
-	if debugLogEnabled {
-		log.Printf(fmt.Sprintf("> "+format+"\n", params))
-	}
+	X int `json:"x"`
+	Y int `json:"y"`
 }
 
 func removePlayer(player *Player) {
@@ -236,36 +231,8 @@ func addPlayer(player *Player) {
 	Players = append(Players, player)
 }
 
-func removeBomb(bomb *Bomb) {
-	bombsMU.Lock()
-	defer bombsMU.Unlock()
-
-	for i, b := range Bombs {
-		if b.Id == bomb.Id {
-			Bombs = append(Bombs[:i], Bombs[i+1:]...)
-		}
-	}
-}
-
-func addBomb(bomb *Bomb) {
-	bombsMU.Lock()
-	defer bombsMU.Unlock()
-
-	Bombs = append(Bombs, bomb)
-}
-
 func isTileBlocking(mapType string, x, y int) bool {
-	bombsMU.Lock()
-	defer bombsMU.Unlock()
-
-	var idx = x + y*maps[mapType].Layers[0].Width
-	var gid = maps[mapType].Layers[0].Data[idx]
-
-	if gid > 0 {
-		return true
-	}
-
-	return false
+	return getMap(mapType).isBlocking(x, y)
 }
 
 func inPointList(desiredX, desiredY int, list []*Point) bool {
@@ -278,11 +245,6 @@ func inPointList(desiredX, desiredY int, list []*Point) bool {
 	return false
 }
 
-func randomInt(min, max int) int {
-	rand.Seed(time.Now().UTC().UnixNano())
-	return rand.Intn(max-min) + min
-}
-
 func getCurrentTimestamp() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
@@ -294,19 +256,7 @@ func createBombAddedMessage(bomb *Bomb) BombAddedMessage {
 		playerID = bomb.Player.Id
 	}
 
-	return BombAddedMessage{Type: "bomb-added", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, MovementDelay: bomb.MovementDelay, CreatedAt: bomb.CreatedAt, FireDelay: bomb.FireDelay, FireLength: bomb.FireLength, Player: playerID}
-}
-
-func quantityOfNPCs() int {
-	total := 0
-
-	for _, player := range Players {
-		if player.NPC {
-			total += 1
-		}
-	}
-
-	return total
+	return BombAddedMessage{Type: "bomb-added", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, MovementDelay: bomb.MovementDelay, CreatedAt: bomb.CreatedAt, FireDelay: bomb.FireDelay, FireLength: bomb.FireLength, Player: playerID, Moving: bomb.Moving}
 }
 
 func (p *Player) createSimpleMessage(messageType string) SimpleMessage {
@@ -318,23 +268,29 @@ func (p *Player) createPositionMessage(new bool) PlayerPositionMessage {
 }
 
 func (p *Player) createPlayerMoveOkMessage() PlayerMoveOkMessage {
-	return PlayerMoveOkMessage{Type: "move-ok", X: p.X, Y: p.Y, Id: p.Id, Direction: p.Direction}
+	return PlayerMoveOkMessage{Type: "move-ok", X: p.X, Y: p.Y, Id: p.Id, Direction: p.Direction, Seq: p.LastMoveSeq}
 }
 
 func (p *Player) createInvalidPositionMessage(toX, toY, toDirection int) PlayerInvalidPositionMessage {
-	return PlayerInvalidPositionMessage{Type: "move-invalid", X: p.X, Y: p.Y, Id: p.Id, Direction: p.Direction, ToX: toX, ToY: toY, ToDirection: toDirection}
+	return PlayerInvalidPositionMessage{Type: "move-invalid", X: p.X, Y: p.Y, Id: p.Id, Direction: p.Direction, ToX: toX, ToY: toY, ToDirection: toDirection, Seq: p.LastMoveSeq}
 }
 
 func (p *Player) createPlayerDataMessage() PlayerDataMessage {
-	return PlayerDataMessage{Type: "player-data", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map}
+	mapHash := ""
+
+	if m := p.Room.getMap(p.Map); m != nil {
+		mapHash = m.Hash
+	}
+
+	return PlayerDataMessage{Type: "player-data", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map, MapHash: mapHash, Team: p.Team, PosX: p.PosX, PosY: p.PosY, Speed: p.Speed, CanKick: p.CanKick, BombTypes: p.BombTypes, Lives: p.Lives, ShieldUntil: p.ShieldUntil, BombCapacity: p.BombCapacity, FireLength: p.FireLength, Ability: p.Ability}
 }
 
 func (p *Player) createPlayerAddedMessage() PlayerDataMessage {
-	return PlayerDataMessage{Type: "player-added", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map}
+	return PlayerDataMessage{Type: "player-added", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map, Team: p.Team, PosX: p.PosX, PosY: p.PosY, Speed: p.Speed, CanKick: p.CanKick, BombTypes: p.BombTypes, Lives: p.Lives, ShieldUntil: p.ShieldUntil, BombCapacity: p.BombCapacity, FireLength: p.FireLength, Ability: p.Ability}
 }
 
 func (p *Player) createPlayerDeadMessage() PlayerDataMessage {
-	return PlayerDataMessage{Type: "player-dead", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map}
+	return PlayerDataMessage{Type: "player-dead", X: p.X, Y: p.Y, Id: p.Id, CharType: p.CharType, Direction: p.Direction, MovementDelay: p.MovementDelay, Map: p.Map, Team: p.Team, PosX: p.PosX, PosY: p.PosY, Speed: p.Speed, CanKick: p.CanKick, BombTypes: p.BombTypes, Lives: p.Lives, ShieldUntil: p.ShieldUntil, BombCapacity: p.BombCapacity, FireLength: p.FireLength, Ability: p.Ability}
 }
 
 func (p *Player) createPlayerRemovedMessage() PlayerRemovedMessage {
@@ -356,24 +312,43 @@ func (p *Player) createBombAddedMessage(bomb *Bomb) BombAddedMessage {
 		playerID = bomb.Player.Id
 	}
 
-	return BombAddedMessage{Type: "bomb-added", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, MovementDelay: bomb.MovementDelay, CreatedAt: bomb.CreatedAt, FireDelay: bomb.FireDelay, FireLength: bomb.FireLength, Player: playerID}
+	return BombAddedMessage{Type: "bomb-added", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, MovementDelay: bomb.MovementDelay, CreatedAt: bomb.CreatedAt, FireDelay: bomb.FireDelay, FireLength: bomb.FireLength, Player: playerID, Moving: bomb.Moving}
+}
+
+func (p *Player) createBombFiredMessage(bomb *Bomb, cells []*Point) BombFiredMessage {
+	return createBombFiredMessage(bomb, cells)
 }
 
-func (p *Player) createBombFiredMessage(bomb *Bomb) BombFiredMessage {
+func createBombFiredMessage(bomb *Bomb, cells []*Point) BombFiredMessage {
 	playerID := ""
 
 	if bomb.Player != nil {
 		playerID = bomb.Player.Id
 	}
 
-	return BombFiredMessage{Type: "bomb-fired", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, FireLength: bomb.FireLength, Player: playerID}
+	return BombFiredMessage{Type: "bomb-fired", Id: bomb.Id, X: bomb.X, Y: bomb.Y, BombType: bomb.BombType, Direction: bomb.Direction, FireLength: bomb.FireLength, Player: playerID, Cells: cells}
 }
 
-func (p *Player) createBombAddInvalidMessage(bombX, bombY int) BombAddInvalidMessage {
-	return BombAddInvalidMessage{Type: "bomb-add-invalid", X: p.X, Y: p.Y, ToX: bombX, ToY: bombY}
+func (p *Player) createBombAddInvalidMessage(bombX, bombY int, bombType string, err error) BombAddInvalidMessage {
+	reason := ""
+
+	if err != nil {
+		reason = err.Error()
+	}
+
+	return BombAddInvalidMessage{Type: "bomb-add-invalid", X: p.X, Y: p.Y, ToX: bombX, ToY: bombY, BombType: bombType, Reason: reason}
 }
 
+// send envia a mensagem para o player, gravando no replay da sala
 func (p *Player) send(v interface{}) error {
+	if p.Room != nil && p.Socket != nil && !p.Spectator {
+		p.Room.record(ReplayOut, p.Id, v)
+	}
+
+	return p.write(v)
+}
+
+func (p *Player) write(v interface{}) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -381,24 +356,58 @@ func (p *Player) send(v interface{}) error {
 		return nil
 	}
 
-	debug(fmt.Sprintf("Message sent: %v", v))
+	logNet.Debug("Message sent", "player", p.Id, "message", v)
 	return websocket.JSON.Send(p.Socket, v)
 }
 
+// sendToAll envia a mensagem para os outros players e espectadores da sala
 func (p *Player) sendToAll(v interface{}) {
+	room := p.Room
+
+	if room == nil {
+		return
+	}
+
+	room.record(ReplayOut, "", v)
+
 	go func() {
-		for _, player := range Players {
+		for _, player := range room.audience() {
 			if player.Id != p.Id {
 				var err error
 
-				if err = player.send(v); err != nil {
-					debug(fmt.Sprintf("Error on send command: %v", err))
+				if err = player.write(v); err != nil {
+					logNet.Debug("Error on send command", "player", player.Id, "error", err)
 				}
 			}
 		}
 	}()
 }
 
+// killPlayer marca o player como morto e avisa todos; os npcs são removidos e
+// os humanos continuam conectados aguardando a próxima rodada
+func killPlayer(p *Player, killer *Player) {
+	room := p.Room
+	p.Online = false
+
+	if killer != nil && killer.Id != p.Id {
+		killer.Kills++
+	}
+
+	if room != nil {
+		room.Match.scoreKill(killer, p)
+	}
+
+	if err := p.send(p.createSimpleMessage("dead")); err != nil {
+		logNet.Debug("Error on send command", "player", p.Id, "error", err)
+	}
+
+	p.sendToAll(p.createPlayerDeadMessage())
+
+	if p.NPC && room != nil {
+		room.removePlayer(p)
+	}
+}
+
 func (p *Player) updateLastMovementTime() {
 	p.LastMovementTime = getCurrentTimestamp()
 }
@@ -414,33 +423,32 @@ func (p *Player) canMoveTo(toX, toY, toDirection int) bool {
 	diff := currentTime - lastMovementTime
 
 	if diff <= p.MovementDelay {
-		debug(fmt.Sprintf("Player cannot move (movement delay) - %v, %v, %v", currentTime, lastMovementTime, diff))
+		logGame.Debug("Player cannot move (movement delay)", "player", p.Id, "map", p.Map, "currentTime", currentTime, "lastMovementTime", lastMovementTime, "diff", diff)
 		return false
 	}
 
 	// valida o tile
-	var tileBlocking = isTileBlocking(p.Map, toX, toY)
+	var tileBlocking = p.Room.isBlocking(p.Map, toX, toY)
 
 	if tileBlocking {
-		debug("Player cannot move (map block)")
+		logGame.Debug("Player cannot move (map block)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	}
 
-	// valida a posição
-	if toX > (p.X + 1) {
-		debug("Player cannot move (invalid position - too far)")
-		return false
-	} else if toX < (p.X - 1) {
-		debug("Player cannot move (invalid position - too far)")
-		return false
-	} else if toY < (p.Y - 1) {
-		debug("Player cannot move (invalid position - too far)")
-		return false
-	} else if toY > (p.Y + 1) {
-		debug("Player cannot move (invalid position - too far)")
+	// valida a posição: somente um tile na horizontal ou na vertical
+	if math.Abs(float64(toX-p.X))+math.Abs(float64(toY-p.Y)) != 1 {
+		logGame.Debug("Player cannot move (invalid position - too far)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	}
 
+	// valida as bombas: o dono pode sair da bomba que colocou, mas não voltar
+	if p.Room != nil {
+		if bomb := p.Room.bombAt(p.Map, toX, toY); bomb != nil && bomb.isSolid() {
+			logGame.Debug("Player cannot move (bomb block)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -451,31 +459,39 @@ func (p *Player) canAddBombTo(toX, toY int) bool {
 	diff := currentTime - lastAddBombTime
 
 	if diff <= p.AddBombDelay {
-		debug(fmt.Sprintf("Player cannot add bomb (add bomb delay) - %v, %v, %v", currentTime, lastAddBombTime, diff))
+		logGame.Debug("Player cannot add bomb (add bomb delay)", "player", p.Id, "map", p.Map, "currentTime", currentTime, "lastAddBombTime", lastAddBombTime, "diff", diff)
 		return false
 	}
 
 	// valida o tile
-	var idx = toX + toY*maps[p.Map].Layers[0].Width
-	var gid = maps[p.Map].Layers[0].Data[idx]
+	if p.Room.isBlocking(p.Map, toX, toY) {
+		logGame.Debug("Player cannot add bomb (map block)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
+		return false
+	}
+
+	if p.Room != nil && p.Room.bombAt(p.Map, toX, toY) != nil {
+		logGame.Debug("Player cannot add bomb (bomb block)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
+		return false
+	}
 
-	if gid > 0 {
-		debug("Player cannot add bomb (map block)")
+	// valida a quantidade de bombas do personagem
+	if p.BombCapacity > 0 && p.activeBombs() >= p.BombCapacity {
+		logGame.Debug("Player cannot add bomb (bomb capacity)", "player", p.Id, "map", p.Map, "capacity", p.BombCapacity)
 		return false
 	}
 
 	// valida a posição
 	if toX > (p.X + 1) {
-		debug("Player cannot add bomb (invalid position - too far)")
+		logGame.Debug("Player cannot add bomb (invalid position - too far)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	} else if toX < (p.X - 1) {
-		debug("Player cannot add bomb (invalid position - too far)")
+		logGame.Debug("Player cannot add bomb (invalid position - too far)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	} else if toY < (p.Y - 1) {
-		debug("Player cannot add bomb (invalid position - too far)")
+		logGame.Debug("Player cannot add bomb (invalid position - too far)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	} else if toY > (p.Y + 1) {
-		debug("Player cannot add bomb (invalid position - too far)")
+		logGame.Debug("Player cannot add bomb (invalid position - too far)", "player", p.Id, "map", p.Map, "x", toX, "y", toY)
 		return false
 	}
 
@@ -493,26 +509,29 @@ func (p *Player) isNearOf(fromPlayer *Player, maxDistance int) bool {
 }
 
 func wsHandler(ws *websocket.Conn) {
-	// faz o upgrade da conexão pra websocket
-	debug(fmt.Sprintf("New connection from: %+v", ws.RemoteAddr()))
-
 	// cria o novo player
 	player := new(Player)
 	player.Id = uuid.New()
 	player.Socket = ws
 
-	player.Map = "map0001"
-	player.CharType = "007"
+	// faz o upgrade da conexão pra websocket
+	connLog := logNet.With("player", player.Id, "remote", ws.Request().RemoteAddr)
+	connLog.Info("New connection")
+
+	player.Map = defaultMapName
+	player.CharType = defaultCharacter
 	player.Direction = 3
-	player.MovementDelay = 200 //float64(randomInt(50, 200))
 	player.LastMovementTime = getCurrentTimestamp()
 	player.LastPingTime = getCurrentTimestamp()
 	player.LastAddBombTime = getCurrentTimestamp()
 	player.AddBombDelay = 1000
 	player.Online = false
 	player.NPC = false
-	player.X = 0
-	player.Y = 0
+	player.Lives = *playerLives
+	player.applyCharacter()
+	player.setTile(0, 0)
+
+	addConnection(player)
 
 	// listen para comandos ou erros
 	for {
@@ -521,82 +540,72 @@ func wsHandler(ws *websocket.Conn) {
 		message := messageRaw[:messageLength]
 
 		if err != nil {
-			debug(fmt.Sprintf("Error on player: %v", err))
+			connLog.Debug("Error on player", "error", err)
 
 			// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 			// erro no socket e foi desconectado - envia essa informação para todos
 			// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
-			for _, p := range Players {
-				if p.Id == player.Id {
-					removePlayer(p)
-				} else {
-					debug(fmt.Sprintf("Destroy player: %v", player))
+			if player.Room != nil {
+				player.Room.leave(player)
+			}
 
-					if err = p.send(player.createPlayerRemovedMessage()); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
-					}
-				}
+			if player.Replay != nil {
+				player.Replay.stop()
 			}
 
-			debug(fmt.Sprintf("Players connected: %v", len(Players)))
+			removePlayer(player)
+			removeConnection(player)
+
+			connLog.Info("Player disconnected", "players", len(Players))
 
 			break
 		}
 
-		debug(fmt.Sprintf("Message received: %v - %v", string(message), messageLength))
+		connLog.Debug("Message received", "message", string(message), "length", messageLength)
 
 		var messageData map[string]interface{}
 
 		if err := json.Unmarshal(message, &messageData); err != nil {
-			debug(fmt.Sprintf("Erro while decode message: %v", err))
+			connLog.Warn("Error while decode message", "error", err)
 		} else {
 			messageDataType := messageData["type"]
+			msgLog := connLog.With("type", messageDataType, "map", player.Map)
+
+			// grava as intenções dos players da sala no replay
+			if player.Room != nil && !player.Spectator && messageDataType != "ping" {
+				player.Room.record(ReplayIn, player.Id, json.RawMessage(message))
+			}
 
 			if messageDataType == "ping" {
 				// ++++++++++++++++++++++++++++++++++++++++++
 				// ping - comando para validar o delay no cliente
 				// ++++++++++++++++++++++++++++++++++++++++++
 				if err = player.send(player.createPongMessage()); err != nil {
-					debug(fmt.Sprintf("Error on send command: %v", err))
+					logNet.Debug("Error on send command", "player", player.Id, "error", err)
 				}
 
 				player.updateLastPingTime()
 			} else if messageDataType == "move" {
 				// ++++++++++++++++++++++++++++++++++++++++++
-				// move = posição do personagem
+				// move = intenção de movimento (direção e sequência)
 				// ++++++++++++++++++++++++++++++++++++++++++
 
-				var toX, toY, toDirection int
-
-				if value, ok := messageData["x"]; ok {
-					toX = int(value.(float64))
-				}
+				var seq int64
+				var toDirection int
 
-				if value, ok := messageData["y"]; ok {
-					toY = int(value.(float64))
+				if value, ok := messageData["seq"].(float64); ok {
+					seq = int64(value)
 				}
 
-				if value, ok := messageData["direction"]; ok {
-					toDirection = int(value.(float64))
+				if value, ok := messageData["direction"].(float64); ok {
+					toDirection = int(value)
 				}
 
-				if player.canMoveTo(toX, toY, toDirection) {
-					player.updateLastMovementTime()
-
-					player.X = toX
-					player.Y = toY
-					player.Direction = toDirection
-
-					if err = player.send(player.createPlayerMoveOkMessage()); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
-					}
-
-					player.sendToAll(player.createPositionMessage(false))
+				if *continuousMovement {
+					player.setMoveIntent(seq, toDirection)
 				} else {
-					if err = player.send(player.createInvalidPositionMessage(toX, toY, toDirection)); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
-					}
+					player.processMoveIntent(seq, toDirection)
 				}
 			} else if messageDataType == "login" {
 				// ++++++++++++++++++++++++++++++++++++++++++
@@ -620,10 +629,10 @@ func wsHandler(ws *websocket.Conn) {
 				}
 
 				if version != appVersion {
-					debug(fmt.Sprintf("Player is trying use a different version: %v", version))
+					msgLog.Info("Player is trying use a different version", "version", version)
 
 					if err = player.send(player.createSimpleMessage("version-invalid")); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
 					}
 
 					player.Socket.Close()
@@ -631,19 +640,21 @@ func wsHandler(ws *websocket.Conn) {
 
 				if username == "demo" && password == "demo" {
 					// cria o novo player
-					debug(fmt.Sprintf("New player logged: %v - %v", username, password))
+					msgLog.Info("New player logged", "username", username)
 
 					addPlayer(player)
-					debug(fmt.Sprintf("New player: %v", player))
+					msgLog.Debug("New player", "players", len(Players))
 
 					if err = player.send(player.createSimpleMessage("login-ok")); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
 					}
+
+					player.joinPublicRoom()
 				} else {
-					debug(fmt.Sprintf("Player is trying do login with a invalid username and password: %v - %v", username, password))
+					msgLog.Info("Player is trying do login with a invalid username and password", "username", username)
 
 					if err = player.send(player.createSimpleMessage("login-invalid")); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
 					}
 
 					player.Socket.Close()
@@ -652,54 +663,316 @@ func wsHandler(ws *websocket.Conn) {
 				// ++++++++++++++++++++++++++++++++++++++++++
 				// game-data = dados do jogo
 				// ++++++++++++++++++++++++++++++++++++++++++
-				debug("Sending player data...")
+				room := player.Room
 
-				player.Online = true
+				if room == nil || player.Spectator {
+					if err = player.send(player.createLobbyInvalidMessage("game-data-invalid", "", errRoomNotJoined)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
 
-				var tileBlocking = true
-				var playerPosX = 0
-				var playerPosY = 0
+					continue
+				}
 
-				for tileBlocking {
-					playerPosX = randomInt(0, maps[player.Map].Layers[0].Width-1)
-					playerPosY = randomInt(0, maps[player.Map].Layers[0].Height-1)
-					tileBlocking = isTileBlocking(player.Map, playerPosX, playerPosY)
+				msgLog.Debug("Sending player data...")
 
-					if !tileBlocking {
-						player.X = playerPosX
-						player.Y = playerPosY
-					}
+				// atributos do personagem escolhido
+				player.applyCharacter()
+
+				// fora do jogo o player só entra na próxima rodada
+				if !player.Online {
+					player.Map = room.Rotation.currentMap()
+
+					spawnPoint := room.selectSpawnPoint(player.Map, player)
+					player.setTile(spawnPoint.X, spawnPoint.Y)
 				}
 
 				if err = player.send(player.createPlayerDataMessage()); err != nil {
-					debug(fmt.Sprintf("Error on send command: %v", err))
+					logNet.Debug("Error on send command", "player", player.Id, "error", err)
 				}
 
-				debug("Sent")
+				if err = player.send(room.Match.createMatchStateMessage()); err != nil {
+					logNet.Debug("Error on send command", "player", player.Id, "error", err)
+				}
+
+				msgLog.Debug("Sent")
 
-				// envia a posição do novo player para todos
-				debug("Publishing positions...")
+				// envia a posição do novo player para todos da sala
+				msgLog.Debug("Publishing positions...")
 
 				go func() {
-					for _, p := range Players {
+					for _, p := range room.players() {
 						if p.Id != player.Id {
-							if err = player.send(p.createPlayerAddedMessage()); err != nil {
-								debug(fmt.Sprintf("Error on send command: %v", err))
+							if p.Online {
+								if err = player.send(p.createPlayerAddedMessage()); err != nil {
+									logNet.Debug("Error on send command", "player", player.Id, "error", err)
+								}
 							}
 
-							if err = p.send(player.createPlayerAddedMessage()); err != nil {
-								debug(fmt.Sprintf("Error on send command: %v", err))
-							}
 						}
 					}
+
+					if player.Online {
+						player.sendToAll(player.createPlayerAddedMessage())
+					}
 				}()
 
-				debug("Published")
+				msgLog.Debug("Published")
+			} else if messageDataType == "map-request" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// map-request = envia o mapa completo
+				// ++++++++++++++++++++++++++++++++++++++++++
+				mapName := player.Map
+
+				if value, ok := messageData["map"].(string); ok && value != "" {
+					mapName = value
+				}
+
+				if m := player.Room.getMap(mapName); m != nil {
+					msgLog.Debug("Sending map data", "requested", mapName, "hash", m.Hash)
+
+					if err = player.send(createMapDataMessage(mapName, m)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				} else {
+					msgLog.Debug("Map not found", "requested", mapName)
+
+					if err = player.send(createMapInvalidMessage(mapName)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "map-vote" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// map-vote = voto no próximo mapa
+				// ++++++++++++++++++++++++++++++++++++++++++
+				mapName, _ := messageData["map"].(string)
+
+				if player.Room == nil || player.Spectator {
+					if err = player.send(MapVoteInvalidMessage{Type: "map-vote-invalid", Map: mapName}); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				} else if votes, ok := player.Room.Rotation.vote(player, mapName); ok {
+					msgLog.Debug("Player voted", "vote", mapName)
+					player.Room.broadcast(MapVoteUpdateMessage{Type: "map-vote-update", Votes: votes})
+				} else {
+					if err = player.send(MapVoteInvalidMessage{Type: "map-vote-invalid", Map: mapName}); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "lobby-create" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// lobby-create = cria uma sala privada
+				// ++++++++++++++++++++++++++++++++++++++++++
+				var team = 0
+
+				// time escolhido pelo player (opcional, no modo de times)
+				if value, ok := messageData["team"].(float64); ok {
+					team = int(value)
+				}
+
+				// mapa gerado na hora (opcional)
+				if _, err := createRoom(player, team, roomMapOptions(messageData)); err != nil {
+					msgLog.Debug("Cannot create room", "reason", err)
+
+					if err = player.send(player.createLobbyInvalidMessage("lobby-create-invalid", "", err)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "lobby-join" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// lobby-join = entra em uma sala pelo código
+				// ++++++++++++++++++++++++++++++++++++++++++
+				var team = 0
+
+				code, _ := messageData["code"].(string)
+				code = strings.ToUpper(strings.TrimSpace(code))
+
+				if value, ok := messageData["team"].(float64); ok {
+					team = int(value)
+				}
+
+				joinErr := errRoomNotFound
+
+				if room := findRoom(code); room != nil {
+					joinErr = room.join(player, team)
+				}
+
+				if joinErr != nil {
+					msgLog.Debug("Cannot join room", "room", code, "reason", joinErr)
+
+					if err = player.send(player.createLobbyInvalidMessage("lobby-join-invalid", code, joinErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "lobby-leave" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// lobby-leave = sai da sala
+				// ++++++++++++++++++++++++++++++++++++++++++
+				if player.Room != nil && (!player.Room.Public || player.Spectator) {
+					player.Room.leave(player)
+
+					if err = player.send(player.createSimpleMessage("lobby-left")); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+
+					// volta para a sala pública
+					player.joinPublicRoom()
+				} else {
+					if err = player.send(player.createLobbyInvalidMessage("lobby-leave-invalid", "", errRoomNotJoined)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "lobby-ready" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// lobby-ready = marca ou desmarca o player como pronto
+				// ++++++++++++++++++++++++++++++++++++++++++
+				var ready = true
+
+				if value, ok := messageData["ready"].(bool); ok {
+					ready = value
+				}
+
+				readyErr := errRoomNotJoined
+
+				if player.Room != nil {
+					readyErr = player.Room.setReady(player, ready)
+				}
+
+				if readyErr != nil {
+					if err = player.send(player.createLobbyInvalidMessage("lobby-ready-invalid", "", readyErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "lobby-start" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// lobby-start = o host inicia a partida
+				// ++++++++++++++++++++++++++++++++++++++++++
+				startErr := errRoomNotJoined
+				code := ""
+
+				if player.Room != nil {
+					code = player.Room.Code
+					startErr = player.Room.start(player)
+				}
+
+				if startErr != nil {
+					msgLog.Debug("Cannot start room", "room", code, "reason", startErr)
+
+					if err = player.send(player.createLobbyInvalidMessage("lobby-start-invalid", code, startErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "spectate" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// spectate = assiste uma sala sem entrar no jogo
+				// ++++++++++++++++++++++++++++++++++++++++++
+				code, _ := messageData["code"].(string)
+				code = strings.ToUpper(strings.TrimSpace(code))
+				follow, _ := messageData["follow"].(string)
+
+				spectateErr := errRoomNotFound
+
+				if room := findRoom(code); room != nil {
+					spectateErr = room.spectate(player, follow)
+				}
+
+				if spectateErr != nil {
+					msgLog.Debug("Cannot spectate room", "room", code, "reason", spectateErr)
+
+					if err = player.send(player.createLobbyInvalidMessage("spectate-invalid", code, spectateErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "spectate-follow" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// spectate-follow = troca o player acompanhado
+				// ++++++++++++++++++++++++++++++++++++++++++
+				id, _ := messageData["id"].(string)
+				followErr := errRoomNotJoined
+
+				if player.Room != nil && player.Spectator {
+					followErr = player.Room.follow(player, id)
+				}
+
+				if followErr != nil {
+					if err = player.send(player.createLobbyInvalidMessage("spectate-follow-invalid", "", followErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "replay" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// replay = assiste uma partida gravada
+				// ++++++++++++++++++++++++++++++++++++++++++
+				name, _ := messageData["name"].(string)
+				speed, _ := messageData["speed"].(float64)
+
+				replayErr := errRoomAlreadyJoined
+
+				if player.Room == nil || (player.Room.Public && !player.Spectator) {
+					public := player.Room != nil
+					player.leavePublicRoom()
+
+					if replayErr = playReplay(player, name, speed, public); replayErr != nil {
+						player.joinPublicRoom()
+					}
+				}
+
+				if replayErr != nil {
+					msgLog.Debug("Cannot play replay", "replay", name, "reason", replayErr)
+
+					if err = player.send(ReplayInvalidMessage{Type: "replay-invalid", Name: name, Reason: replayErr.Error()}); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "replay-speed" || messageDataType == "replay-stop" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// replay-speed e replay-stop = controlam o replay
+				// ++++++++++++++++++++++++++++++++++++++++++
+				playback := player.Replay
+
+				if playback == nil {
+					if err = player.send(ReplayInvalidMessage{Type: fmt.Sprintf("%s-invalid", messageDataType), Reason: errReplayNotPlaying.Error()}); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				} else if messageDataType == "replay-speed" {
+					speed, _ := messageData["speed"].(float64)
+					playback.setSpeed(speed)
+				} else if playback.stop() {
+					player.finishReplay(playback)
+				}
+			} else if messageDataType == "character-list" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// character-list = catálogo de personagens
+				// ++++++++++++++++++++++++++++++++++++++++++
+				if err = player.send(createCharacterListMessage()); err != nil {
+					logNet.Debug("Error on send command", "player", player.Id, "error", err)
+				}
+			} else if messageDataType == "character-select" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// character-select = escolhe o personagem
+				// ++++++++++++++++++++++++++++++++++++++++++
+				charType, _ := messageData["charType"].(string)
+
+				if err := player.selectCharacter(charType); err != nil {
+					if err = player.send(player.createCharacterSelectInvalidMessage(charType, err)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
+			} else if messageDataType == "bomb-detonate" {
+				// ++++++++++++++++++++++++++++++++++++++++++
+				// bomb-detonate = explode uma bomba remota do player
+				// ++++++++++++++++++++++++++++++++++++++++++
+				id, _ := messageData["id"].(string)
+
+				if err := player.detonateBomb(id); err != nil {
+					if err = player.send(player.createBombDetonateInvalidMessage(id, err)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				}
 			} else if messageDataType == "bomb-add" {
 				// ++++++++++++++++++++++++++++++++++++++++++
 				// bomb-add = adiciona uma nova bomba
 				// ++++++++++++++++++++++++++++++++++++++++++
-				debug("Adding new bomb...")
+				msgLog.Debug("Adding new bomb...")
 
 				var bombX, bombY int
 
@@ -711,37 +984,41 @@ func wsHandler(ws *websocket.Conn) {
 					bombY = int(value.(float64))
 				}
 
-				if player.canAddBombTo(bombX, bombY) {
+				bombTypeName, _ := messageData["bombType"].(string)
+				bombType, bombTypeErr := player.selectBombType(bombTypeName)
+
+				room := player.Room
+
+				if bombTypeErr != nil {
+					if err = player.send(player.createBombAddInvalidMessage(bombX, bombY, bombTypeName, bombTypeErr)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
+					}
+				} else if room != nil && !player.Spectator && room.Match.allowsPlay() && player.canAddBombTo(bombX, bombY) {
 					player.LastAddBombTime = getCurrentTimestamp()
 
 					bomb := &Bomb{
 						Id:               uuid.New(),
 						X:                bombX,
 						Y:                bombY,
-						BombType:         "001",
-						Direction:        1,
-						MovementDelay:    0,
+						BombType:         bombType.Id,
+						Direction:        player.Direction,
+						MovementDelay:    bombSlideDelay.Milliseconds(),
 						LastMovementTime: getCurrentTimestamp(),
 						CreatedAt:        getCurrentTimestamp(),
-						FireDelay:        2000,
-						FireLength:       3,
+						FireDelay:        bombType.FireDelay,
+						FireLength:       player.bombFireLength(bombType),
 						Player:           player,
+						Map:              player.Map,
 					}
 
-					addBomb(bomb)
+					room.addBomb(bomb)
 
-					go func() {
-						for _, p := range Players {
-							if err = p.send(player.createBombAddedMessage(bomb)); err != nil {
-								debug(fmt.Sprintf("Error on send command: %v", err))
-							}
-						}
-					}()
+					go room.announceBomb(bomb)
 
-					debug(fmt.Sprintf("Added and published (ID: %v", bomb.Id))
+					msgLog.Debug("Added and published", "bomb", bomb.Id)
 				} else {
-					if err = player.send(player.createBombAddInvalidMessage(bombX, bombY)); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
+					if err = player.send(player.createBombAddInvalidMessage(bombX, bombY, bombType.Id, nil)); err != nil {
+						logNet.Debug("Error on send command", "player", player.Id, "error", err)
 					}
 				}
 			}
@@ -752,7 +1029,7 @@ func wsHandler(ws *websocket.Conn) {
 				for _, p := range Players {
 					if p.Id != player.Id {
 						if err = p.send(player.createPositionMessage(false)); err != nil {
-							debug(fmt.Sprintf("Error on send command: %v", err))
+							logNet.Debug("Error on send command", "player", p.Id, "error", err)
 						}
 					}
 
@@ -762,54 +1039,95 @@ func wsHandler(ws *websocket.Conn) {
 	}
 }
 
-func loadMaps() {
-	debug("Loading map files...")
+func main() {
+	// subcomandos
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		if err := runGenerateCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate map: %v\n", err)
+			os.Exit(1)
+		}
 
-	// geral
-	path := "maps/*.json"
-	fileList, err := filepath.Glob(path)
+		return
+	}
 
-	if err != nil {
-		debugf("Failed to load map files: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "replays" {
+		if err := runReplaysCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to run replays command: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	flag.Parse()
+
+	if err := setupLogging(*logFormat, *logLevel, *logSubsystemLevels); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	debugf("Map files found: %v", len(fileList))
+	http.Handle("/ws", websocket.Handler(wsHandler))
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", readyzHandler)
+	http.HandleFunc("/admin/log-level", adminOnly(logLevelHandler))
+	http.HandleFunc("/admin/maps/reload", adminOnly(mapsReloadHandler))
+	http.HandleFunc("/admin/maps/generate", adminOnly(mapsGenerateHandler))
+	http.HandleFunc("/maps/", mapHandler)
+	http.Handle("/public", http.FileServer(http.Dir("public")))
 
-	// carrega todos os arquivos
-	for _, mapFile := range fileList {
-		debugf("Loading map: %s", mapFile)
+	server := &http.Server{Addr: *listenAddress}
 
-		file, err := ioutil.ReadFile(mapFile)
-		fileName := filepath.Base(mapFile)
-		fileExtension := filepath.Ext(mapFile)
-		fileNameBase := fileName[0 : len(fileName)-len(fileExtension)]
+	go func() {
+		logHTTP.Info("Server listening", "address", server.Addr)
 
-		if err != nil {
-			debugf("Failed to load map: %s - %v", fileName, err)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logHTTP.Error("Fatal Error", "error", err)
 			os.Exit(1)
 		}
+	}()
 
-		var m Map
-		json.Unmarshal(file, &m)
+	if err := loadMaps(); err != nil {
+		logMaps.Error("Failed to load maps", "error", err)
+		os.Exit(1)
+	}
 
-		// remove todas as layers que não usamos
-		debugf("Removing unused layers from map: %s...", fileName)
+	if err := setupRotation(*mapRotationList); err != nil {
+		logMaps.Error("Invalid map rotation", "error", err)
+		os.Exit(1)
+	}
 
-		for currentLayerKey, currentLayer := range m.Layers {
-			if currentLayer.Name != "Meta" {
-				m.Layers = append(m.Layers[:currentLayerKey], m.Layers[currentLayerKey+1:]...)
-			}
-		}
+	if *bombSlideDelay < time.Millisecond {
+		logBombs.Error("Invalid bomb slide delay, must be at least 1ms", "delay", *bombSlideDelay)
+		os.Exit(1)
+	}
 
-		maps[fileNameBase] = &m
+	if types, err := parseBombTypes(*unlockedBombTypes); err != nil {
+		logBombs.Error("Invalid bomb types", "error", err)
+		os.Exit(1)
+	} else {
+		playerBombTypes = types
+	}
 
-		debugf("Map %s loaded", fileName)
+	if err := loadCharacters(*charactersFile); err != nil {
+		logGame.Error("Failed to load characters", "error", err)
+		os.Exit(1)
 	}
-}
 
-func main() {
-	loadMaps()
+	serverReady.Store(true)
+
+	createPublicRoom()
+
+	if *mapsWatchInterval > 0 {
+		go watchMaps(*mapsWatchInterval)
+	}
+
+	if *spectatorSnapshotInterval > 0 {
+		go watchSpectators(*spectatorSnapshotInterval)
+	}
+
+	if *continuousMovement {
+		go runContinuousMovement(*movementTick)
+	}
 
 	/*
 		gin.SetMode(gin.ReleaseMode)
@@ -835,88 +1153,32 @@ func main() {
 		// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 		for range tickerBombs.C {
-			for _, bomb := range Bombs {
-				debugf("Bombs to proccess: %d", len(Bombs))
-
-				currentTime := getCurrentTimestamp()
-				bombCreatedAt := bomb.CreatedAt
-				diff := currentTime - bombCreatedAt
-
-				if diff > bomb.FireDelay {
-					debug(fmt.Sprintf("Bomb to be removed (ID: %v", bomb.Id))
-
-					removeBomb(bomb)
-
-					var explosionPointList = make([]*Point, 0)
-					explosionPointList = append(explosionPointList, &Point{X: bomb.X, Y: bomb.Y})
+			for _, room := range listRooms() {
+				bombs := room.bombs()
 
-					for x := 0; x < bomb.FireLength; x++ {
-						explosionPointList = append(explosionPointList, &Point{X: bomb.X + (x + 1), Y: bomb.Y})
-						explosionPointList = append(explosionPointList, &Point{X: bomb.X - (x + 1), Y: bomb.Y})
-						explosionPointList = append(explosionPointList, &Point{X: bomb.X, Y: bomb.Y + (x + 1)})
-						explosionPointList = append(explosionPointList, &Point{X: bomb.X, Y: bomb.Y - (x + 1)})
-					}
-
-					for _, p := range Players {
-						//debug(fmt.Sprintf("Sending bomb-fired command to: %v", p.Id))
-
-						collidedWithPlayer := inPointList(p.X, p.Y, explosionPointList)
-						var err error
-
-						if err = p.send(p.createBombFiredMessage(bomb)); err != nil {
-							debug(fmt.Sprintf("Error on send command: %v", err))
-						}
+				for _, bomb := range bombs {
+					logBombs.Debug("Bombs to proccess", "room", room.Code, "count", len(bombs))
 
-						if collidedWithPlayer {
-							p.Online = false
-
-							if err = p.send(p.createSimpleMessage("dead")); err != nil {
-								debug(fmt.Sprintf("Error on send command: %v", err))
-							}
-
-							p.sendToAll(p.createPlayerDeadMessage())
-
-							removePlayer(p)
-						}
+					if room.isTriggered(bomb) {
+						room.explodeBomb(bomb)
 					}
 				}
+
+				// os power-ups são pegos no mesmo passo da simulação das bombas
+				room.updatePowerUps()
 			}
 		}
 	}()
 
 	go func() {
 		// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
-		// essa rotina adiciona bombas aleatoriamente
+		// essa rotina anuncia e coloca as bombas de perigo dos mapas
 		// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
-		for range tickerAddBombs.C {
-			mapName := "map0001"
-			bombX := randomInt(0, maps[mapName].Layers[0].Width-1)
-			bombY := randomInt(0, maps[mapName].Layers[0].Height-1)
-
-			bomb := &Bomb{
-				Id:               uuid.New(),
-				X:                bombX,
-				Y:                bombY,
-				BombType:         "001",
-				Direction:        1,
-				MovementDelay:    0,
-				LastMovementTime: getCurrentTimestamp(),
-				CreatedAt:        getCurrentTimestamp(),
-				FireDelay:        2000,
-				FireLength:       randomInt(1, 9),
-				Player:           nil,
+		for range tickerHazards.C {
+			for _, room := range listRooms() {
+				room.updateHazards()
 			}
-
-			addBomb(bomb)
-
-			go func() {
-				for _, p := range Players {
-					if err := p.send(createBombAddedMessage(bomb)); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
-					}
-				}
-			}()
 		}
 	}()
 
@@ -926,139 +1188,126 @@ func main() {
 		// +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 		for range tickerAddNPC.C {
-			quantityOfNPCs := quantityOfNPCs()
-
-			if quantityOfNPCs >= maxQuantityOfNPCs {
-				debugf("Cannot add more NPCs: %d", quantityOfNPCs)
-				continue
-			}
+			for _, room := range listRooms() {
+				quantityOfNPCs := room.quantityOfNPCs()
 
-			debugf("Quantity of NPCs: %d", quantityOfNPCs)
+				if quantityOfNPCs >= maxQuantityOfNPCs {
+					logNPC.Debug("Cannot add more NPCs", "room", room.Code, "count", quantityOfNPCs)
+					continue
+				}
 
-			charTypeRand := randomInt(3, 6)
-			charType := fmt.Sprintf("00%d", charTypeRand)
+				logNPC.Debug("Quantity of NPCs", "room", room.Code, "count", quantityOfNPCs)
 
-			mapName := "map0001"
-			playerX := randomInt(0, maps[mapName].Layers[0].Width-1)
-			playerY := randomInt(0, maps[mapName].Layers[0].Height-1)
+				npcCharacters := npcCharacters()
+				charType := npcCharacters[room.randomInt(0, len(npcCharacters))]
 
-			player := new(Player)
-			player.Id = uuid.New()
-			player.Socket = nil
+				if !room.Match.allowsPlay() {
+					continue
+				}
 
-			player.Map = mapName
-			player.CharType = charType
-			player.Direction = 3
-			player.MovementDelay = int64(randomInt(200, 1000))
-			player.LastMovementTime = getCurrentTimestamp()
-			player.LastPingTime = getCurrentTimestamp()
-			player.LastAddBombTime = getCurrentTimestamp()
-			player.AddBombDelay = 5000
-			player.Online = true
-			player.X = playerX
-			player.Y = playerY
-			player.NPC = true
+				mapName := room.Rotation.currentMap()
+				player := new(Player)
+				player.Id = uuid.New()
+				player.Socket = nil
+
+				player.Map = mapName
+				player.CharType = charType
+				player.applyCharacter()
+				player.Direction = 3
+				player.LastMovementTime = getCurrentTimestamp()
+				player.LastPingTime = getCurrentTimestamp()
+				player.LastAddBombTime = getCurrentTimestamp()
+				player.AddBombDelay = 5000
+				player.Online = true
+				player.NPC = true
+				player.Lives = 1
+				player.Room = room
 
-			addPlayer(player)
+				spawnPoint := room.selectSpawnPoint(mapName, player)
+				player.setTile(spawnPoint.X, spawnPoint.Y)
 
-			go func() {
-				for _, p := range Players {
-					if err := p.send(player.createPlayerAddedMessage()); err != nil {
-						debug(fmt.Sprintf("Error on send command: %v", err))
-					}
-				}
-			}()
+				room.addPlayer(player)
 
-			go func() {
-				for player != nil && player.Online {
-					toDirection := randomInt(0, 4)
-					toDirection += 1
-
-					toX := player.X
-					toY := player.Y
-
-					if toDirection == 1 {
-						toY = player.Y - 1
-					} else if toDirection == 2 {
-						toX = player.X + 1
-					} else if toDirection == 3 {
-						toY = player.Y + 1
-					} else if toDirection == 4 {
-						toX = player.X - 1
-					}
+				go room.broadcast(player.createPlayerAddedMessage())
 
-					if toX > (maps[mapName].Layers[0].Width - 1) {
-						toX = (maps[mapName].Layers[0].Width - 1)
-					} else if toY > (maps[mapName].Layers[0].Height - 1) {
-						toY = (maps[mapName].Layers[0].Height - 1)
-					} else if toX < 0 {
-						toX = 0
-					} else if toY < 0 {
-						toY = 0
-					}
+				go func() {
+					for player != nil && player.Online {
+						toDirection := room.randomInt(0, 4)
+						toDirection += 1
+
+						toX, toY, _ := player.moveTarget(toDirection)
+
+						if toX > (room.getMap(mapName).Meta.Width - 1) {
+							toX = (room.getMap(mapName).Meta.Width - 1)
+						} else if toY > (room.getMap(mapName).Meta.Height - 1) {
+							toY = (room.getMap(mapName).Meta.Height - 1)
+						} else if toX < 0 {
+							toX = 0
+						} else if toY < 0 {
+							toY = 0
+						}
 
-					sleepDuration := time.Duration(player.MovementDelay * int64(time.Millisecond))
+						sleepDuration := time.Duration(player.MovementDelay * int64(time.Millisecond))
 
-					if player.canMoveTo(toX, toY, toDirection) {
-						player.updateLastMovementTime()
+						if player.canMoveTo(toX, toY, toDirection) {
+							player.updateLastMovementTime()
 
-						player.X = toX
-						player.Y = toY
-						player.Direction = toDirection
+							player.setTile(toX, toY)
+							player.Direction = toDirection
 
-						player.sendToAll(player.createPositionMessage(false))
-					}
+							player.sendToAll(player.createPositionMessage(false))
+						}
 
-					for _, p := range Players {
-						if p.Id != player.Id {
-							if player.isNearOf(p, 2) {
-								bombX := player.X
-								bombY := player.Y
-
-								if player.canAddBombTo(bombX, bombY) {
-									player.LastAddBombTime = getCurrentTimestamp()
-
-									bomb := &Bomb{
-										Id:               uuid.New(),
-										X:                bombX,
-										Y:                bombY,
-										BombType:         "001",
-										Direction:        1,
-										MovementDelay:    0,
-										LastMovementTime: getCurrentTimestamp(),
-										CreatedAt:        getCurrentTimestamp(),
-										FireDelay:        2000,
-										FireLength:       randomInt(1, 9),
-										Player:           player,
-									}
+						for _, p := range room.players() {
+							if p.Id != player.Id {
+								if player.isNearOf(p, 2) {
+									bombX := player.X
+									bombY := player.Y
+
+									if player.canAddBombTo(bombX, bombY) {
+										player.LastAddBombTime = getCurrentTimestamp()
+
+										bomb := &Bomb{
+											Id:               uuid.New(),
+											X:                bombX,
+											Y:                bombY,
+											BombType:         BombTypeNormal,
+											Direction:        1,
+											MovementDelay:    bombSlideDelay.Milliseconds(),
+											LastMovementTime: getCurrentTimestamp(),
+											CreatedAt:        getCurrentTimestamp(),
+											FireDelay:        2000,
+											FireLength:       player.bombFireLength(bombTypes[BombTypeNormal]),
+											Player:           player,
+											Map:              player.Map,
+										}
 
-									addBomb(bomb)
+										room.addBomb(bomb)
 
-									go func() {
-										for _, p := range Players {
-											if err := p.send(player.createBombAddedMessage(bomb)); err != nil {
-												debug(fmt.Sprintf("Error on send command: %v", err))
-											}
-										}
-									}()
+										go room.announceBomb(bomb)
+									}
 								}
 							}
 						}
-					}
 
-					time.Sleep(sleepDuration)
-				}
-			}()
+						time.Sleep(sleepDuration)
+					}
+				}()
+			}
 		}
 	}()
 
-	http.Handle("/ws", websocket.Handler(wsHandler))
-	http.Handle("/public", http.FileServer(http.Dir("public")))
+	// aguarda o sinal para encerrar o servidor
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
 
-	err := http.ListenAndServe(":3030", nil)
+	sig := <-signals
+	logHTTP.Info("Shutting down server", "signal", sig.String(), "timeout", *shutdownTimeout)
 
-	if err != nil {
-		debug("Fatal Error: " + err.Error())
+	if err := shutdownServer(server, *shutdownTimeout, *reconnectAfter); err != nil {
+		logHTTP.Error("Error on shutdown server", "error", err)
 		os.Exit(1)
 	}
+
+	logHTTP.Info("Server stopped")
 }
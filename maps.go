@@ -0,0 +1,480 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var mapsDirectory = flag.String("maps-dir", "maps", "directory with the Tiled map files")
+var skipInvalidMaps = flag.Bool("skip-invalid-maps", false, "skip invalid map files instead of refusing to start")
+
+var mapsWatchInterval = flag.Duration("maps-watch-interval", 2*time.Second, "interval to check map files for changes (0 disables)")
+
+var defaultMapName = "map0001"
+var maps = make(map[string]*Map)
+var mapsMU sync.RWMutex
+
+// data de modificação dos arquivos já carregados
+var mapFiles = make(map[string]time.Time)
+
+type MapReloadedMessage struct {
+	Type string `json:"type"`
+	Map  string `json:"map"`
+	Hash string `json:"hash"`
+}
+
+type MapDataMessage struct {
+	Type string          `json:"type"`
+	Map  string          `json:"map"`
+	Hash string          `json:"hash"`
+	Data json.RawMessage `json:"data"`
+}
+
+type MapInvalidMessage struct {
+	Type string `json:"type"`
+	Map  string `json:"map"`
+}
+
+// isBlocking retorna true para tiles bloqueados ou fora do mapa
+func (m *Map) isBlocking(x, y int) bool {
+	if x < 0 || y < 0 || x >= m.Meta.Width || y >= m.Meta.Height {
+		return true
+	}
+
+	return m.Meta.Data.Tiles[x+y*m.Meta.Width] > 0
+}
+
+func (m *Map) validate() error {
+	var errs []error
+
+	if m.Width <= 0 || m.Height <= 0 {
+		errs = append(errs, fmt.Errorf("invalid map size %dx%d", m.Width, m.Height))
+	}
+
+	if m.Tilewidth <= 0 || m.Tileheight <= 0 {
+		errs = append(errs, fmt.Errorf("invalid tile size %dx%d", m.Tilewidth, m.Tileheight))
+	}
+
+	// os tilesets não podem ter gids sobrepostos
+	for i, tileset := range m.Tilesets {
+		if tileset.Firstgid <= 0 || tileset.Tilecount <= 0 {
+			errs = append(errs, fmt.Errorf("tileset %q: invalid firstgid %d or tilecount %d", tileset.Name, tileset.Firstgid, tileset.Tilecount))
+			continue
+		}
+
+		for _, other := range m.Tilesets[:i] {
+			if tileset.Firstgid < other.Firstgid+other.Tilecount && other.Firstgid < tileset.Firstgid+tileset.Tilecount {
+				errs = append(errs, fmt.Errorf("tileset %q: gids overlap with tileset %q", tileset.Name, other.Name))
+			}
+		}
+	}
+
+	m.Meta = nil
+	hasMeta := false
+
+	for _, layer := range m.allLayers() {
+		if layer.Type != "tilelayer" {
+			continue
+		}
+
+		if layer.Name == "Meta" {
+			hasMeta = true
+		}
+
+		if layer.Width != m.Width || layer.Height != m.Height {
+			errs = append(errs, fmt.Errorf("layer %q: size %dx%d does not match map size %dx%d", layer.Name, layer.Width, layer.Height, m.Width, m.Height))
+		}
+
+		if len(layer.tiles()) != layer.Width*layer.Height {
+			errs = append(errs, fmt.Errorf("layer %q: data length %d does not match %dx%d", layer.Name, len(layer.tiles()), layer.Width, layer.Height))
+			continue
+		}
+
+		for idx, gid := range layer.tiles() {
+			if gid != 0 && m.tilesetForGid(gid) == nil {
+				errs = append(errs, fmt.Errorf("layer %q: gid %d at %d,%d does not belong to any tileset", layer.Name, gid, idx%layer.Width, idx/layer.Width))
+				break
+			}
+		}
+
+		if layer.Name == "Meta" {
+			m.Meta = layer
+		}
+	}
+
+	if !hasMeta {
+		errs = append(errs, errors.New(`required tile layer "Meta" not found`))
+	}
+
+	if hazards, err := m.parseHazardConfig(); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.Hazards = hazards
+	}
+
+	return errors.Join(errs...)
+}
+
+func loadMap(mapFile string) (*Map, error) {
+	file, err := os.ReadFile(mapFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buildMap(mapFile, file)
+}
+
+// buildMap decodifica e valida o conteúdo de um mapa, calculando o conteúdo
+// enviado aos clientes e seu hash
+func buildMap(mapFile string, file []byte) (*Map, error) {
+	m, err := parseMap(mapFile, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	// os clientes recebem o mapa normalizado em json, qualquer que seja o
+	// formato do arquivo: layers decodificadas, mapas infinitos convertidos em
+	// finitos e tilesets externos embutidos, nas mesmas coordenadas do servidor
+	raw, err := json.Marshal(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(raw)
+	m.Raw = raw
+	m.Hash = hex.EncodeToString(hash[:])
+
+	return m, nil
+}
+
+func getMap(name string) *Map {
+	mapsMU.RLock()
+	defer mapsMU.RUnlock()
+
+	return maps[name]
+}
+
+func setMap(name string, m *Map) {
+	mapsMU.Lock()
+	defer mapsMU.Unlock()
+
+	maps[name] = m
+}
+
+// getMap retorna a versão do mapa usada pela sala (ou a carregada, fora de
+// uma sala ou antes da primeira rodada)
+func (r *Room) getMap(name string) *Map {
+	if r != nil {
+		r.mapsMU.Lock()
+		m := r.Maps[name]
+		r.mapsMU.Unlock()
+
+		if m != nil {
+			return m
+		}
+	}
+
+	return getMap(name)
+}
+
+// useMap fixa a versão carregada do mapa para as próximas rodadas da sala (um
+// mapa removido continua com a versão anterior) e retorna a nova versão quando
+// ela substituiu uma versão já usada pela sala
+func (r *Room) useMap(name string) *Map {
+	m := getMap(name)
+
+	if m == nil {
+		return nil
+	}
+
+	r.mapsMU.Lock()
+	defer r.mapsMU.Unlock()
+
+	previous := r.Maps[name]
+	r.Maps[name] = m
+
+	if previous != nil && previous.Hash != m.Hash {
+		return m
+	}
+
+	return nil
+}
+
+// isPinned retorna true quando a sala já fixou uma versão do mapa
+func (r *Room) isPinned(name string) bool {
+	r.mapsMU.Lock()
+	defer r.mapsMU.Unlock()
+
+	return r.Maps[name] != nil
+}
+
+func mapNameFromFile(mapFile string) string {
+	fileName := filepath.Base(mapFile)
+	fileExtension := filepath.Ext(mapFile)
+
+	return fileName[0 : len(fileName)-len(fileExtension)]
+}
+
+func listMapFiles() ([]string, error) {
+	fileList := make([]string, 0)
+
+	for _, extension := range []string{"*.json", "*.tmx"} {
+		files, err := filepath.Glob(filepath.Join(*mapsDirectory, extension))
+
+		if err != nil {
+			return nil, err
+		}
+
+		fileList = append(fileList, files...)
+	}
+
+	return fileList, nil
+}
+
+func createMapReloadedMessage(name string, m *Map) MapReloadedMessage {
+	return MapReloadedMessage{Type: "map-reloaded", Map: name, Hash: m.Hash}
+}
+
+func createMapDataMessage(name string, m *Map) MapDataMessage {
+	return MapDataMessage{Type: "map-data", Map: name, Hash: m.Hash, Data: m.Raw}
+}
+
+func createMapInvalidMessage(name string) MapInvalidMessage {
+	return MapInvalidMessage{Type: "map-invalid", Map: name}
+}
+
+func loadMaps() error {
+	logMaps.Info("Loading map files...")
+
+	// geral
+	fileList, err := listMapFiles()
+
+	if err != nil {
+		return fmt.Errorf("failed to list map files: %w", err)
+	}
+
+	logMaps.Info("Map files found", "count", len(fileList))
+
+	// carrega todos os arquivos
+	for _, mapFile := range fileList {
+		logMaps.Debug("Loading map", "file", mapFile)
+
+		fileName := filepath.Base(mapFile)
+		info, err := os.Stat(mapFile)
+
+		if err != nil {
+			return fmt.Errorf("map %s: %w", fileName, err)
+		}
+
+		m, err := loadMap(mapFile)
+
+		if err != nil {
+			if *skipInvalidMaps {
+				logMaps.Warn("Skipping invalid map", "file", fileName, "error", err)
+				continue
+			}
+
+			return fmt.Errorf("map %s: %w", fileName, err)
+		}
+
+		setMap(mapNameFromFile(mapFile), m)
+		mapFiles[mapFile] = info.ModTime()
+
+		logMaps.Info("Map loaded", "file", fileName, "width", m.Width, "height", m.Height)
+	}
+
+	if getMap(defaultMapName) == nil {
+		return fmt.Errorf("default map %q not loaded", defaultMapName)
+	}
+
+	return nil
+}
+
+// reloadMaps recarrega os arquivos novos ou alterados desde a última carga,
+// mantendo a versão anterior de qualquer mapa que não passar na validação
+func reloadMaps(force bool) ([]string, error) {
+	fileList, err := listMapFiles()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list map files: %w", err)
+	}
+
+	reloaded := make([]string, 0)
+	var errs []error
+
+	removeDeletedMaps(fileList)
+
+	for _, mapFile := range fileList {
+		info, err := os.Stat(mapFile)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("map %s: %w", filepath.Base(mapFile), err))
+			continue
+		}
+
+		mapsMU.RLock()
+		lastModTime, loaded := mapFiles[mapFile]
+		mapsMU.RUnlock()
+
+		if loaded && !force && info.ModTime().Equal(lastModTime) {
+			continue
+		}
+
+		m, err := loadMap(mapFile)
+
+		mapsMU.Lock()
+		mapFiles[mapFile] = info.ModTime()
+		mapsMU.Unlock()
+
+		if err != nil {
+			logMaps.Warn("Invalid map not reloaded", "file", mapFile, "error", err)
+			errs = append(errs, fmt.Errorf("map %s: %w", filepath.Base(mapFile), err))
+			continue
+		}
+
+		name := mapNameFromFile(mapFile)
+		setMap(name, m)
+		reloaded = append(reloaded, name)
+
+		logMaps.Info("Map reloaded", "map", name, "width", m.Width, "height", m.Height)
+
+		notifyMapReloaded(name, m)
+	}
+
+	return reloaded, errors.Join(errs...)
+}
+
+// removeDeletedMaps tira do conjunto os mapas cujos arquivos foram apagados;
+// o mapa padrão e os mapas da rotação continuam com a última versão
+func removeDeletedMaps(fileList []string) {
+	files := make(map[string]bool)
+
+	for _, mapFile := range fileList {
+		files[mapFile] = true
+	}
+
+	mapsMU.Lock()
+	defer mapsMU.Unlock()
+
+	for mapFile := range mapFiles {
+		if files[mapFile] {
+			continue
+		}
+
+		name := mapNameFromFile(mapFile)
+		delete(mapFiles, mapFile)
+
+		if inRotation(name) {
+			logMaps.Warn("Map file deleted, keeping the loaded map in rotation", "map", name, "file", mapFile)
+			continue
+		}
+
+		delete(maps, name)
+
+		logMaps.Info("Map removed", "map", name, "file", mapFile)
+	}
+}
+
+// notifyMapReloaded avisa os players que estão no mapa recarregado fora de uma
+// sala que já fixou a versão anterior; essas salas avisam ao trocar de mapa
+func notifyMapReloaded(name string, m *Map) {
+	playersMU.Lock()
+	players := make([]*Player, len(Players))
+	copy(players, Players)
+	playersMU.Unlock()
+
+	for _, p := range players {
+		if p.Map != name || (p.Room != nil && p.Room.isPinned(name)) {
+			continue
+		}
+
+		if err := p.send(createMapReloadedMessage(name, m)); err != nil {
+			logNet.Debug("Error on send command", "player", p.Id, "error", err)
+		}
+	}
+}
+
+// watchMaps verifica periodicamente se os arquivos de mapa foram alterados
+func watchMaps(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !serverReady.Load() {
+			return
+		}
+
+		if _, err := reloadMaps(false); err != nil {
+			logMaps.Debug("Map files with errors", "error", err)
+		}
+	}
+}
+
+// mapsReloadHandler força a recarga de todos os mapas (POST)
+func mapsReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reloaded, err := reloadMaps(true)
+
+	result := map[string]interface{}{"reloaded": reloaded}
+	status := http.StatusOK
+
+	if err != nil {
+		result["error"] = err.Error()
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// mapHandler envia o arquivo completo do mapa, com o hash no ETag para que
+// o cliente possa validar a versão que já possui
+func mapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/maps/")
+	m := getMap(name)
+
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"` + m.Hash + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Map-Hash", m.Hash)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(m.Raw)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var matchRounds = flag.Int("match-rounds", 3, "rounds of a match (best of N)")
+var matchMinPlayers = flag.Int("match-min-players", 2, "players needed to start a match")
+var publicMinPlayers = flag.Int("public-min-players", 1, "players needed to start a match in the public room")
+var countdownDuration = flag.Duration("countdown-duration", 5*time.Second, "countdown before each round")
+var roundOverDuration = flag.Duration("round-over-duration", 5*time.Second, "time showing the round results")
+var matchOverDuration = flag.Duration("match-over-duration", 10*time.Second, "time showing the match results")
+
+// estados da partida
+const (
+	MatchStateLobby     = "lobby"
+	MatchStateCountdown = "countdown"
+	MatchStatePlaying   = "playing"
+	MatchStateRoundOver = "round-over"
+	MatchStateMatchOver = "match-over"
+)
+
+type MatchStateMessage struct {
+	Type        string         `json:"type"`
+	State       string         `json:"state"`
+	Round       int            `json:"round"`
+	Rounds      int            `json:"rounds"`
+	EndsAt      int64          `json:"endsAt"`
+	Winner      string         `json:"winner"`
+	Reason      string         `json:"reason"`
+	Wins        map[string]int `json:"wins"`
+	Scores      map[string]int `json:"scores,omitempty"`
+	SuddenDeath bool           `json:"suddenDeath"`
+}
+
+// Match controla o ciclo lobby -> countdown -> playing -> round-over ->
+// (match-over) de uma sala e a contagem de rodadas vencidas por player (ou time)
+type Match struct {
+	mu   sync.Mutex
+	room *Room
+
+	State          string
+	Round          int
+	Wins           map[string]int
+	RoundStartedAt int64
+	RoundPlayers   int
+	RoundTeams     int
+	TeamScores     map[string]int
+	EndsAt         int64
+	Winner         string
+	Reason         string
+	StartRequested bool
+	SuddenDeath    bool
+}
+
+func newMatch(room *Room) *Match {
+	return &Match{room: room, State: MatchStateLobby, Wins: make(map[string]int), TeamScores: make(map[string]int)}
+}
+
+func (m *Match) createMatchStateMessage() MatchStateMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wins := make(map[string]int)
+
+	for id, total := range m.Wins {
+		wins[id] = total
+	}
+
+	var scores map[string]int
+
+	if teamsEnabled() {
+		scores = make(map[string]int)
+
+		for team := 1; team <= *teamCount; team++ {
+			scores[teamName(team)] = m.TeamScores[teamName(team)]
+		}
+	}
+
+	return MatchStateMessage{Type: "match-state", State: m.State, Round: m.Round, Rounds: *matchRounds, EndsAt: m.EndsAt, Winner: m.Winner, Reason: m.Reason, Wins: wins, Scores: scores, SuddenDeath: m.SuddenDeath}
+}
+
+func (m *Match) currentState() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.State
+}
+
+// allowsPlay retorna true quando os players podem andar e colocar bombas
+// (somente com a rodada em andamento)
+func (m *Match) allowsPlay() bool {
+	return m.currentState() == MatchStatePlaying
+}
+
+// requestStart pede para a máquina de estados sair do lobby
+func (m *Match) requestStart() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.StartRequested = true
+}
+
+func (m *Match) setState(state string, duration time.Duration) {
+	m.mu.Lock()
+	m.State = state
+	m.EndsAt = 0
+
+	if duration > 0 {
+		m.EndsAt = getCurrentTimestamp() + duration.Milliseconds()
+	}
+
+	round := m.Round
+	m.mu.Unlock()
+
+	logGame.Info("Match state changed", "room", m.room.Code, "state", state, "round", round)
+
+	m.room.broadcast(m.createMatchStateMessage())
+}
+
+// humanPlayers retorna a quantidade de players humanos na sala e os vivos
+func (r *Room) humanPlayers() (connected int, alive []*Player) {
+	for _, p := range r.humans() {
+		connected++
+
+		if p.Online {
+			alive = append(alive, p)
+		}
+	}
+
+	return connected, alive
+}
+
+// roundResult retorna o motivo do fim da rodada (ou vazio se ela continua) e
+// o vencedor: o último vivo, ou no tempo esgotado o vivo com mais abates
+func (m *Match) roundResult() (string, string) {
+	_, alive := m.room.humanPlayers()
+
+	m.mu.Lock()
+	roundPlayers := m.RoundPlayers
+	roundTeams := m.RoundTeams
+	roundStartedAt := m.RoundStartedAt
+	m.mu.Unlock()
+
+	timeUp := *roundDuration > 0 && getCurrentTimestamp()-roundStartedAt >= roundDuration.Milliseconds()
+
+	if teamsEnabled() {
+		return teamRoundResult(alive, roundTeams, timeUp)
+	}
+
+	if len(alive) == 0 {
+		return "all-players-dead", ""
+	}
+
+	if roundPlayers > 1 && len(alive) == 1 {
+		return "last-player-standing", alive[0].Id
+	}
+
+	if timeUp {
+		winner := ""
+		bestKills := -1
+
+		for _, p := range alive {
+			if p.Kills > bestKills {
+				winner = p.Id
+				bestKills = p.Kills
+			} else if p.Kills == bestKills {
+				winner = ""
+			}
+		}
+
+		return "time-limit", winner
+	}
+
+	return "", ""
+}
+
+// matchWinner retorna o vencedor da partida quando ela termina (melhor de N)
+func (m *Match) matchWinner() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	winner := ""
+	bestWins := 0
+
+	for id, total := range m.Wins {
+		if total > *matchRounds/2 {
+			return id, true
+		}
+
+		if total > bestWins {
+			winner = id
+			bestWins = total
+		} else if total == bestWins {
+			winner = ""
+		}
+	}
+
+	return winner, m.Round >= *matchRounds
+}
+
+func (m *Match) startCountdown(mapName string) {
+	m.mu.Lock()
+	firstRound := m.Round == 0
+	m.mu.Unlock()
+
+	// cada partida começa com o gerador reiniciado e é gravada desde a
+	// primeira rodada
+	if firstRound {
+		m.room.reseed(newSimulationSeed())
+		m.room.startRecording()
+	}
+
+	// reinicia o mapa e revive todos os players para a próxima rodada
+	m.room.changeMap(mapName)
+
+	m.mu.Lock()
+	m.Round++
+	m.Winner = ""
+	m.Reason = ""
+	m.mu.Unlock()
+
+	m.setState(MatchStateCountdown, *countdownDuration)
+}
+
+func (m *Match) startRound() {
+	connected, _ := m.room.humanPlayers()
+
+	for _, p := range m.room.players() {
+		p.Kills = 0
+	}
+
+	m.mu.Lock()
+	m.RoundStartedAt = getCurrentTimestamp()
+	m.RoundPlayers = connected
+	m.RoundTeams = m.room.connectedTeams()
+	m.SuddenDeath = false
+	m.mu.Unlock()
+
+	m.room.resetLives()
+	m.setState(MatchStatePlaying, *roundDuration)
+}
+
+// finishRound mostra o resultado da rodada e da partida (se terminou) e faz a
+// votação do próximo mapa antes de seguir para a próxima rodada ou o lobby
+func (m *Match) finishRound(reason, winner string) {
+	m.mu.Lock()
+	m.Reason = reason
+	m.Winner = winner
+
+	if winner != "" {
+		m.Wins[winner]++
+	}
+	m.mu.Unlock()
+
+	logGame.Info("Round finished", "room", m.room.Code, "reason", reason, "winner", winner)
+
+	m.setState(MatchStateRoundOver, *roundOverDuration)
+	time.Sleep(*roundOverDuration)
+
+	matchWinner, matchOver := m.matchWinner()
+
+	if matchOver {
+		m.mu.Lock()
+		m.Reason = "rounds-finished"
+		m.Winner = matchWinner
+		m.mu.Unlock()
+
+		logGame.Info("Match finished", "room", m.room.Code, "winner", matchWinner)
+
+		m.setState(MatchStateMatchOver, *matchOverDuration)
+		time.Sleep(*matchOverDuration)
+	}
+
+	nextMap := m.room.Rotation.runMapVote(reason)
+
+	if matchOver {
+		m.reset()
+		return
+	}
+
+	m.startCountdown(nextMap)
+}
+
+// reset volta para o lobby da sala, zerando as rodadas, vitórias e prontos
+func (m *Match) reset() {
+	m.room.clearWorld()
+
+	m.mu.Lock()
+	m.Round = 0
+	m.Wins = make(map[string]int)
+	m.TeamScores = make(map[string]int)
+	m.Winner = ""
+	m.Reason = ""
+	m.StartRequested = false
+	m.mu.Unlock()
+
+	m.setState(MatchStateLobby, 0)
+	m.room.stopRecording()
+	m.room.resetReady()
+}
+
+// run executa a máquina de estados da partida até a sala ser fechada
+func (m *Match) run() {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !serverReady.Load() || m.room.isClosed() {
+			return
+		}
+
+		state := m.currentState()
+
+		m.mu.Lock()
+		endsAt := m.EndsAt
+		startRequested := m.StartRequested
+		m.StartRequested = false
+		m.mu.Unlock()
+
+		switch state {
+		case MatchStateLobby:
+			// a sala pública começa sozinha com players suficientes
+			if startRequested || (m.room.Public && len(m.room.humans()) >= max(*publicMinPlayers, 1)) {
+				m.startCountdown(m.room.Rotation.currentMap())
+			}
+		case MatchStateCountdown:
+			if getCurrentTimestamp() >= endsAt {
+				m.startRound()
+			}
+		case MatchStatePlaying:
+			if reason, winner := m.roundResult(); reason != "" {
+				m.finishRound(reason, winner)
+			} else if m.suddenDeathDue() {
+				m.startSuddenDeath()
+			}
+		}
+	}
+}
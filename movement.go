@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var moveTolerance = flag.Duration("move-tolerance", 50*time.Millisecond, "how early a move intent can arrive and still wait for the movement delay")
+
+// direções usadas nos movimentos (e nas bombas)
+const (
+	DirectionUp    = 1
+	DirectionRight = 2
+	DirectionDown  = 3
+	DirectionLeft  = 4
+)
+
+// directionOffset retorna o deslocamento de um tile na direção
+func directionOffset(direction int) (int, int, bool) {
+	switch direction {
+	case DirectionUp:
+		return 0, -1, true
+	case DirectionRight:
+		return 1, 0, true
+	case DirectionDown:
+		return 0, 1, true
+	case DirectionLeft:
+		return -1, 0, true
+	}
+
+	return 0, 0, false
+}
+
+// moveTarget calcula o tile de destino de uma intenção de movimento
+func (p *Player) moveTarget(direction int) (int, int, bool) {
+	dx, dy, ok := directionOffset(direction)
+	return p.X + dx, p.Y + dy, ok
+}
+
+// waitMovementDelay aguarda o fim do intervalo entre movimentos quando a
+// intenção chega um pouco antes dele (dentro da tolerância), absorvendo a
+// variação da latência da conexão
+func (p *Player) waitMovementDelay() {
+	remaining := p.MovementDelay - (getCurrentTimestamp() - p.LastMovementTime)
+
+	if remaining >= 0 && remaining < moveTolerance.Milliseconds() {
+		time.Sleep(time.Duration(remaining+1) * time.Millisecond)
+	}
+}
+
+// acceptMoveSeq descarta as intenções com sequência antiga; sem seq (0) a
+// intenção não tem ordem e é sempre aceita
+func (p *Player) acceptMoveSeq(seq int64) bool {
+	if seq == 0 {
+		return true
+	}
+
+	if seq <= p.LastMoveSeq {
+		logGame.Debug("Ignoring old move intent", "player", p.Id, "seq", seq, "lastSeq", p.LastMoveSeq)
+		return false
+	}
+
+	p.LastMoveSeq = seq
+
+	return true
+}
+
+// processMoveIntent aplica uma intenção de movimento (direção com número de
+// sequência) e responde com move-ok ou move-invalid com a última sequência
+// processada, permitindo a predição e a reconciliação no cliente
+func (p *Player) processMoveIntent(seq int64, direction int) {
+	if !p.acceptMoveSeq(seq) {
+		return
+	}
+
+	toX, toY, ok := p.moveTarget(direction)
+
+	if ok && p.Room != nil && !p.Spectator && p.Room.Match.allowsPlay() {
+		p.waitMovementDelay()
+		ok = p.canMoveTo(toX, toY, direction)
+
+		// andar contra uma bomba chuta a bomba (o player fica no lugar)
+		if !ok {
+			p.kickBomb(toX, toY, direction)
+		}
+	} else {
+		ok = false
+	}
+
+	if !ok {
+		if err := p.send(p.createInvalidPositionMessage(toX, toY, direction)); err != nil {
+			logNet.Debug("Error on send command", "player", p.Id, "error", err)
+		}
+
+		return
+	}
+
+	p.updateLastMovementTime()
+
+	p.setTile(toX, toY)
+	p.Direction = direction
+
+	if err := p.send(p.createPlayerMoveOkMessage()); err != nil {
+		logNet.Debug("Error on send command", "player", p.Id, "error", err)
+	}
+
+	p.sendToAll(p.createPositionMessage(false))
+}
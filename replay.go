@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var replaysDir = flag.String("replays-dir", "replays", "directory of the match replays (empty disables recording)")
+
+const replayVersion = 1
+const replayExtension = ".replay.gz"
+
+// direção das entradas do replay
+const (
+	ReplayIn  = "in"
+	ReplayOut = "out"
+)
+
+var errReplayNotFound = errors.New("not-found")
+var errReplayPlaying = errors.New("already-playing")
+var errReplayNotPlaying = errors.New("not-playing")
+
+// ReplayHeader é a primeira linha do arquivo de replay
+type ReplayHeader struct {
+	Version      int      `json:"version"`
+	Room         string   `json:"room"`
+	Seed         int64    `json:"seed"`
+	StartedAt    int64    `json:"startedAt"`
+	Maps         []string `json:"maps"`
+	Teams        int      `json:"teams"`
+	FriendlyFire bool     `json:"friendlyFire"`
+}
+
+// ReplayEntry é uma mensagem recebida (in, do player p) ou enviada (out, para
+// o player p ou para toda a sala quando p é vazio), t ms após o início
+type ReplayEntry struct {
+	Time      int64           `json:"t"`
+	Direction string          `json:"d"`
+	Player    string          `json:"p,omitempty"`
+	Message   json.RawMessage `json:"m"`
+}
+
+type ReplayStartMessage struct {
+	Type      string  `json:"type"`
+	Name      string  `json:"name"`
+	Room      string  `json:"room"`
+	Seed      int64   `json:"seed"`
+	StartedAt int64   `json:"startedAt"`
+	Duration  int64   `json:"duration"`
+	Speed     float64 `json:"speed"`
+}
+
+type ReplayInvalidMessage struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Recorder grava as mensagens de uma partida em json por linha comprimido
+type Recorder struct {
+	mu sync.Mutex
+
+	Name      string
+	StartedAt int64
+	Entries   int
+
+	file    *os.File
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+}
+
+// ReplayPlayback controla a reprodução de um replay para uma conexão
+type ReplayPlayback struct {
+	mu sync.Mutex
+
+	Speed   float64
+	Stopped bool
+	Public  bool // a conexão volta para a sala pública no fim do replay
+
+	done chan struct{}
+}
+
+func newRecorder(header ReplayHeader) (*Recorder, error) {
+	if err := os.MkdirAll(*replaysDir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s", time.UnixMilli(header.StartedAt).UTC().Format("20060102-150405"), header.Room)
+	file, err := os.Create(filepath.Join(*replaysDir, name+replayExtension))
+
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &Recorder{Name: name, StartedAt: header.StartedAt, file: file}
+	recorder.gzip = gzip.NewWriter(file)
+	recorder.encoder = json.NewEncoder(recorder.gzip)
+
+	if err := recorder.encoder.Encode(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return recorder, nil
+}
+
+func (r *Recorder) record(direction, player string, v interface{}) {
+	if r == nil {
+		return
+	}
+
+	message, err := json.Marshal(v)
+
+	if err != nil {
+		logGame.Warn("Error on encode replay message", "replay", r.Name, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoder == nil {
+		return
+	}
+
+	entry := ReplayEntry{Time: getCurrentTimestamp() - r.StartedAt, Direction: direction, Player: player, Message: message}
+
+	if err := r.encoder.Encode(entry); err != nil {
+		logGame.Warn("Error on write replay", "replay", r.Name, "error", err)
+		return
+	}
+
+	r.Entries++
+}
+
+func (r *Recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoder == nil {
+		return nil
+	}
+
+	r.encoder = nil
+
+	return errors.Join(r.gzip.Close(), r.file.Close())
+}
+
+// startRecording inicia a gravação da partida da sala
+func (r *Room) startRecording() {
+	if *replaysDir == "" {
+		return
+	}
+
+	r.stopRecording()
+
+	header := ReplayHeader{Version: replayVersion, Room: r.Code, Seed: r.currentSeed(), StartedAt: getCurrentTimestamp(), Maps: append([]string{}, r.Rotation.Maps...), Teams: *teamCount, FriendlyFire: *friendlyFire}
+	recorder, err := newRecorder(header)
+
+	if err != nil {
+		logGame.Error("Error on start recording", "room", r.Code, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	r.Recorder = recorder
+	r.mu.Unlock()
+
+	logGame.Info("Recording started", "room", r.Code, "replay", recorder.Name)
+}
+
+func (r *Room) stopRecording() {
+	r.mu.Lock()
+	recorder := r.Recorder
+	r.Recorder = nil
+	r.mu.Unlock()
+
+	if recorder == nil {
+		return
+	}
+
+	if err := recorder.close(); err != nil {
+		logGame.Error("Error on stop recording", "room", r.Code, "replay", recorder.Name, "error", err)
+		return
+	}
+
+	logGame.Info("Recording finished", "room", r.Code, "replay", recorder.Name, "entries", recorder.Entries)
+}
+
+func (r *Room) record(direction, player string, v interface{}) {
+	r.mu.Lock()
+	recorder := r.Recorder
+	r.mu.Unlock()
+
+	recorder.record(direction, player, v)
+}
+
+func replayFile(name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return "", errReplayNotFound
+	}
+
+	return filepath.Join(*replaysDir, name+replayExtension), nil
+}
+
+// readReplay lê o cabeçalho e as entradas de um replay
+func readReplay(name string) (ReplayHeader, []ReplayEntry, error) {
+	var header ReplayHeader
+
+	path, err := replayFile(name)
+
+	if err != nil {
+		return header, nil, err
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return header, nil, errReplayNotFound
+		}
+
+		return header, nil, err
+	}
+
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+
+	if err != nil {
+		return header, nil, err
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	if err := decoder.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("invalid replay header: %w", err)
+	}
+
+	entries := make([]ReplayEntry, 0)
+
+	for {
+		var entry ReplayEntry
+
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			// replay de um servidor que parou sem fechar o arquivo
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				logGame.Warn("Truncated replay", "replay", name, "entries", len(entries))
+				break
+			}
+
+			return header, nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return header, entries, nil
+}
+
+// listReplays retorna os nomes dos replays gravados, do mais antigo ao mais novo
+func listReplays() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(*replaysDir, "*"+replayExtension))
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), replayExtension))
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func clampReplaySpeed(speed float64) float64 {
+	if speed <= 0 {
+		return 1
+	}
+
+	return min(max(speed, 0.25), 16)
+}
+
+func (p *ReplayPlayback) speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Speed
+}
+
+func (p *ReplayPlayback) setSpeed(speed float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Speed = clampReplaySpeed(speed)
+}
+
+// stop encerra o replay; retorna true somente para a chamada que o encerrou
+func (p *ReplayPlayback) stop() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Stopped {
+		return false
+	}
+
+	p.Stopped = true
+	close(p.done)
+
+	return true
+}
+
+// finishReplay libera a conexão do replay encerrado e a devolve para a sala
+// pública quando ela saiu de lá para assistir
+func (p *Player) finishReplay(playback *ReplayPlayback) {
+	if p.Replay == playback {
+		p.Replay = nil
+	}
+
+	if playback.Public {
+		p.joinPublicRoom()
+	}
+}
+
+// playReplay envia para a conexão os eventos da sala gravados no replay,
+// respeitando os intervalos originais divididos pela velocidade; com public a
+// conexão volta para a sala pública quando o replay termina
+func playReplay(player *Player, name string, speed float64, public bool) error {
+	if player.Replay != nil {
+		return errReplayPlaying
+	}
+
+	header, entries, err := readReplay(name)
+
+	if err != nil {
+		return err
+	}
+
+	playback := &ReplayPlayback{Speed: clampReplaySpeed(speed), Public: public, done: make(chan struct{})}
+	player.Replay = playback
+
+	duration := int64(0)
+
+	if len(entries) > 0 {
+		duration = entries[len(entries)-1].Time
+	}
+
+	if err := player.send(ReplayStartMessage{Type: "replay-start", Name: name, Room: header.Room, Seed: header.Seed, StartedAt: header.StartedAt, Duration: duration, Speed: playback.speed()}); err != nil {
+		logNet.Debug("Error on send command", "player", player.Id, "error", err)
+	}
+
+	logGame.Info("Replay started", "player", player.Id, "replay", name, "entries", len(entries))
+
+	go func() {
+		defer playback.stop()
+
+		last := int64(0)
+
+		for _, entry := range entries {
+			if entry.Direction != ReplayOut || entry.Player != "" {
+				continue
+			}
+
+			wait := float64(entry.Time-last) / playback.speed()
+			last = entry.Time
+
+			select {
+			case <-time.After(time.Duration(wait * float64(time.Millisecond))):
+			case <-playback.done:
+				logGame.Info("Replay stopped", "player", player.Id, "replay", name)
+				return
+			}
+
+			if err := player.send(entry.Message); err != nil {
+				logNet.Debug("Error on send command", "player", player.Id, "error", err)
+				return
+			}
+		}
+
+		if err := player.send(player.createSimpleMessage("replay-end")); err != nil {
+			logNet.Debug("Error on send command", "player", player.Id, "error", err)
+		}
+
+		logGame.Info("Replay finished", "player", player.Id, "replay", name)
+
+		if playback.stop() {
+			player.finishReplay(playback)
+		}
+	}()
+
+	return nil
+}
+
+// runReplaysCommand implementa o subcomando "replays" (list e export)
+func runReplaysCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: replays list|export [options]")
+	}
+
+	flags := flag.NewFlagSet("replays "+args[0], flag.ContinueOnError)
+	flags.StringVar(replaysDir, "replays-dir", *replaysDir, "directory of the match replays")
+	name := flags.String("name", "", "replay to export")
+	output := flags.String("out", "", "export file (default stdout)")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names, err := listReplays()
+
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			header, entries, err := readReplay(name)
+
+			if err != nil {
+				fmt.Printf("%s\tinvalid: %v\n", name, err)
+				continue
+			}
+
+			duration := int64(0)
+
+			if len(entries) > 0 {
+				duration = entries[len(entries)-1].Time
+			}
+
+			fmt.Printf("%s\troom=%s\tseed=%d\tstarted=%s\tduration=%s\tentries=%d\n", name, header.Room, header.Seed, time.UnixMilli(header.StartedAt).UTC().Format(time.RFC3339), time.Duration(duration)*time.Millisecond, len(entries))
+		}
+	case "export":
+		header, entries, err := readReplay(*name)
+
+		if err != nil {
+			return fmt.Errorf("replay %q: %w", *name, err)
+		}
+
+		var writer io.Writer = os.Stdout
+
+		if *output != "" {
+			file, err := os.Create(*output)
+
+			if err != nil {
+				return err
+			}
+
+			defer file.Close()
+			writer = file
+		}
+
+		buffer := bufio.NewWriter(writer)
+		encoder := json.NewEncoder(buffer)
+		encoder.SetIndent("", " ")
+
+		export := struct {
+			Header  ReplayHeader  `json:"header"`
+			Entries []ReplayEntry `json:"entries"`
+		}{header, entries}
+
+		if err := encoder.Encode(export); err != nil {
+			return err
+		}
+
+		return buffer.Flush()
+	default:
+		return fmt.Errorf("unknown replays command %q", args[0])
+	}
+
+	return nil
+}
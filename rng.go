@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var simulationSeed = flag.Int64("seed", 0, "seed of the rooms random generator (0 = a new seed for every match)")
+
+// newSimulationSeed retorna a seed configurada ou uma seed nova
+func newSimulationSeed() int64 {
+	if *simulationSeed != 0 {
+		return *simulationSeed
+	}
+
+	return time.Now().UnixNano()
+}
+
+// reseed reinicia o gerador da sala: spawns, npcs e bombas aleatórias usam
+// somente esse gerador, então a mesma seed com as mesmas entradas repete o jogo
+func (r *Room) reseed(seed int64) {
+	r.rngMU.Lock()
+	r.Seed = seed
+	r.rng = rand.New(rand.NewSource(seed))
+	r.rngMU.Unlock()
+
+	logGame.Info("Room seed", "room", r.Code, "seed", seed)
+}
+
+func (r *Room) currentSeed() int64 {
+	r.rngMU.Lock()
+	defer r.rngMU.Unlock()
+
+	return r.Seed
+}
+
+// randomInt retorna um número entre min (inclusive) e max (exclusive)
+func (r *Room) randomInt(min, max int) int {
+	r.rngMU.Lock()
+	defer r.rngMU.Unlock()
+
+	return r.rng.Intn(max-min) + min
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"sync"
+)
+
+var roomMaxPlayers = flag.Int("room-max-players", 8, "max players in a room")
+
+// caracteres dos códigos das salas (sem 0/O e 1/I para facilitar a digitação)
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const roomCodeLength = 5
+
+// código da sala pública (não colide com os códigos sorteados)
+const publicRoomCode = "PUBLIC"
+
+// motivos de recusa das ações do lobby
+var (
+	errRoomNotFound         = errors.New("not-found")
+	errRoomFull             = errors.New("full")
+	errRoomAlreadyJoined    = errors.New("already-in-lobby")
+	errRoomNotJoined        = errors.New("not-in-lobby")
+	errRoomNotHost          = errors.New("not-host")
+	errRoomNotReady         = errors.New("not-ready")
+	errRoomNotEnoughPlayers = errors.New("not-enough-players")
+	errRoomStarted          = errors.New("started")
+	errRoomInvalidMap       = errors.New("invalid-map")
+)
+
+type LobbyMember struct {
+	Id       string `json:"id"`
+	CharType string `json:"charType"`
+	Team     int    `json:"team"`
+	Ready    bool   `json:"ready"`
+	Host     bool   `json:"host"`
+}
+
+type LobbyStateMessage struct {
+	Type       string        `json:"type"`
+	Code       string        `json:"code"`
+	Host       string        `json:"host"`
+	State      string        `json:"state"`
+	Members    []LobbyMember `json:"members"`
+	Spectators int           `json:"spectators"`
+}
+
+type LobbyInvalidMessage struct {
+	Type   string `json:"type"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// Room é uma partida privada: os players entram pelo código, marcam que estão
+// prontos e o host inicia o jogo; cada sala tem seus players, bombas, partida
+// e rotação de mapas. A sala pública recebe os players no login, não tem host
+// e inicia sozinha
+type Room struct {
+	mu sync.Mutex
+
+	Code   string
+	Host   *Player
+	Ready  map[string]bool
+	Closed bool
+	Public bool
+
+	playersMU  sync.Mutex
+	Players    []*Player
+	Spectators []*Player
+
+	bombsMU sync.Mutex
+	Bombs   []*Bomb
+
+	// bombas de perigo anunciadas
+	hazardsMU    sync.Mutex
+	Hazards      []*Hazard
+	NextHazardAt int64
+
+	powerUpsMU sync.Mutex
+	PowerUps   []*PowerUp
+
+	// tiles alterados na rodada (morte súbita)
+	tilesMU sync.Mutex
+	Tiles   map[Point]int
+
+	// versão dos mapas usada na rodada; mapas recarregados entram somente na
+	// próxima troca de mapa
+	mapsMU sync.Mutex
+	Maps   map[string]*Map
+
+	Match    *Match
+	Rotation *MapRotation
+	Recorder *Recorder
+
+	rngMU sync.Mutex
+	Seed  int64
+	rng   *rand.Rand
+}
+
+var rooms = make(map[string]*Room)
+var roomsMU sync.Mutex
+
+func (p *Player) createLobbyInvalidMessage(messageType, code string, err error) LobbyInvalidMessage {
+	return LobbyInvalidMessage{Type: messageType, Code: code, Reason: err.Error()}
+}
+
+// newRoomCode sorteia um código livre (chamado com roomsMU travado)
+func newRoomCode() string {
+	for {
+		code := make([]byte, roomCodeLength)
+
+		for i := range code {
+			code[i] = roomCodeAlphabet[rand.Intn(len(roomCodeAlphabet))]
+		}
+
+		if _, ok := rooms[string(code)]; !ok {
+			return string(code)
+		}
+	}
+}
+
+func newRoom() *Room {
+	room := &Room{Ready: make(map[string]bool), Players: make([]*Player, 0), Spectators: make([]*Player, 0), Bombs: make([]*Bomb, 0), Tiles: make(map[Point]int), Maps: make(map[string]*Map), Hazards: make([]*Hazard, 0), PowerUps: make([]*PowerUp, 0)}
+	room.Match = newMatch(room)
+	room.Rotation = newMapRotation(room)
+
+	return room
+}
+
+// createPublicRoom cria a sala pública e inicia a sua partida
+func createPublicRoom() {
+	room := newRoom()
+	room.Code = publicRoomCode
+	room.Public = true
+
+	roomsMU.Lock()
+	rooms[room.Code] = room
+	roomsMU.Unlock()
+
+	room.reseed(newSimulationSeed())
+
+	logGame.Info("Public room created", "room", room.Code)
+
+	go room.Match.run()
+}
+
+// createRoom cria uma sala com o player como host e inicia a sua partida; com
+// mapOptions a sala joga somente o mapa gerado, guardado apenas na sala
+func createRoom(host *Player, team int, mapOptions *MapGeneratorOptions) (*Room, error) {
+	if host.Room != nil && !host.Room.Public {
+		return nil, errRoomAlreadyJoined
+	}
+
+	room := newRoom()
+
+	if mapOptions != nil {
+		mapName, m, err := buildGeneratedMap(*mapOptions)
+
+		if err != nil {
+			logMaps.Debug("Cannot generate room map", "error", err)
+			return nil, errRoomInvalidMap
+		}
+
+		room.Maps[mapName] = m
+		room.Rotation.Maps = []string{mapName}
+	}
+
+	roomsMU.Lock()
+	room.Code = newRoomCode()
+	rooms[room.Code] = room
+	roomsMU.Unlock()
+
+	room.reseed(newSimulationSeed())
+	room.Host = host
+
+	if err := room.join(host, team); err != nil {
+		return nil, err
+	}
+
+	logGame.Info("Room created", "room", room.Code, "host", host.Id)
+
+	go room.Match.run()
+
+	return room, nil
+}
+
+func findRoom(code string) *Room {
+	roomsMU.Lock()
+	defer roomsMU.Unlock()
+
+	return rooms[code]
+}
+
+func listRooms() []*Room {
+	roomsMU.Lock()
+	defer roomsMU.Unlock()
+
+	list := make([]*Room, 0, len(rooms))
+
+	for _, room := range rooms {
+		list = append(list, room)
+	}
+
+	return list
+}
+
+func (r *Room) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Closed
+}
+
+// join coloca o player na sala, tirando-o da sala pública; durante a partida
+// ele aguarda a próxima rodada
+func (r *Room) join(p *Player, team int) error {
+	if p.Room != nil && (p.Room == r || !p.Room.Public) {
+		return errRoomAlreadyJoined
+	}
+
+	r.mu.Lock()
+	if r.Closed {
+		r.mu.Unlock()
+		return errRoomNotFound
+	}
+	r.mu.Unlock()
+
+	if len(r.humans()) >= *roomMaxPlayers {
+		return errRoomFull
+	}
+
+	p.leavePublicRoom()
+
+	p.Team = r.assignTeam(team)
+	p.Map = r.Rotation.currentMap()
+	p.Online = false
+	p.Room = r
+
+	r.addPlayer(p)
+
+	logGame.Info("Player joined room", "room", r.Code, "player", p.Id, "team", p.Team)
+
+	r.broadcastLobbyState()
+
+	return nil
+}
+
+// leave tira o player da sala, passando o host para outro player ou fechando
+// a sala quando não sobra ninguém
+func (r *Room) leave(p *Player) {
+	if p.Spectator {
+		r.stopSpectating(p)
+		return
+	}
+
+	r.removePlayer(p)
+	p.Room = nil
+	p.Online = false
+
+	r.broadcast(p.createPlayerRemovedMessage())
+	r.unfollow(p.Id)
+
+	// a sala pública não tem host e não fecha
+	if r.Public {
+		r.mu.Lock()
+		delete(r.Ready, p.Id)
+		r.mu.Unlock()
+
+		logGame.Info("Player left room", "room", r.Code, "player", p.Id)
+
+		r.broadcastLobbyState()
+		return
+	}
+
+	humans := r.humans()
+
+	r.mu.Lock()
+	delete(r.Ready, p.Id)
+
+	if r.Host != nil && r.Host.Id == p.Id {
+		r.Host = nil
+
+		if len(humans) > 0 {
+			r.Host = humans[0]
+		}
+	}
+
+	closed := len(humans) == 0
+	r.Closed = closed
+	r.mu.Unlock()
+
+	logGame.Info("Player left room", "room", r.Code, "player", p.Id)
+
+	if closed {
+		roomsMU.Lock()
+		delete(rooms, r.Code)
+		roomsMU.Unlock()
+
+		r.clearWorld()
+		r.endSpectating()
+		r.stopRecording()
+
+		logGame.Info("Room closed", "room", r.Code)
+		return
+	}
+
+	r.broadcastLobbyState()
+}
+
+// joinPublicRoom coloca o player na sala pública (no login e ao sair de uma sala)
+func (p *Player) joinPublicRoom() {
+	room := findRoom(publicRoomCode)
+
+	if room == nil {
+		return
+	}
+
+	if err := room.join(p, 0); err != nil {
+		logGame.Warn("Player cannot join the public room", "player", p.Id, "reason", err)
+	}
+}
+
+// leavePublicRoom tira o player da sala pública antes de ir para outra sala
+func (p *Player) leavePublicRoom() {
+	if p.Room != nil && p.Room.Public {
+		p.Room.leave(p)
+	}
+}
+
+// setReady marca ou desmarca o player como pronto (somente no lobby)
+func (r *Room) setReady(p *Player, ready bool) error {
+	if p.Spectator {
+		return errSpectator
+	}
+
+	if r.Match.currentState() != MatchStateLobby {
+		return errRoomStarted
+	}
+
+	r.mu.Lock()
+	r.Ready[p.Id] = ready
+	r.mu.Unlock()
+
+	r.broadcastLobbyState()
+
+	return nil
+}
+
+// start é chamado pelo host para iniciar a partida quando todos estão prontos
+func (r *Room) start(p *Player) error {
+	humans := r.humans()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Host == nil || r.Host.Id != p.Id {
+		return errRoomNotHost
+	}
+
+	if r.Match.currentState() != MatchStateLobby {
+		return errRoomStarted
+	}
+
+	if len(humans) < *matchMinPlayers {
+		return errRoomNotEnoughPlayers
+	}
+
+	for _, human := range humans {
+		if human.Id != p.Id && !r.Ready[human.Id] {
+			return errRoomNotReady
+		}
+	}
+
+	r.Match.requestStart()
+
+	logGame.Info("Room started", "room", r.Code, "players", len(humans))
+
+	return nil
+}
+
+// resetReady limpa os prontos quando a sala volta para o lobby
+func (r *Room) resetReady() {
+	r.mu.Lock()
+	r.Ready = make(map[string]bool)
+	r.mu.Unlock()
+
+	r.broadcastLobbyState()
+}
+
+func (r *Room) createLobbyStateMessage() LobbyStateMessage {
+	humans := r.humans()
+	state := r.Match.currentState()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	host := ""
+
+	if r.Host != nil {
+		host = r.Host.Id
+	}
+
+	members := make([]LobbyMember, 0, len(humans))
+
+	for _, p := range humans {
+		members = append(members, LobbyMember{Id: p.Id, CharType: p.CharType, Team: p.Team, Ready: r.Ready[p.Id], Host: p.Id == host})
+	}
+
+	return LobbyStateMessage{Type: "lobby-state", Code: r.Code, Host: host, State: state, Members: members, Spectators: len(r.spectators())}
+}
+
+func (r *Room) broadcastLobbyState() {
+	r.broadcast(r.createLobbyStateMessage())
+}
+
+func (r *Room) addPlayer(player *Player) {
+	r.playersMU.Lock()
+	defer r.playersMU.Unlock()
+
+	r.Players = append(r.Players, player)
+}
+
+func (r *Room) removePlayer(player *Player) {
+	r.playersMU.Lock()
+	defer r.playersMU.Unlock()
+
+	for i, p := range r.Players {
+		if p.Id == player.Id {
+			r.Players = append(r.Players[:i], r.Players[i+1:]...)
+			break
+		}
+	}
+}
+
+// players retorna uma cópia da lista de players (humanos e npcs) da sala
+func (r *Room) players() []*Player {
+	r.playersMU.Lock()
+	defer r.playersMU.Unlock()
+
+	players := make([]*Player, len(r.Players))
+	copy(players, r.Players)
+
+	return players
+}
+
+func (r *Room) humans() []*Player {
+	humans := make([]*Player, 0)
+
+	for _, p := range r.players() {
+		if !p.NPC {
+			humans = append(humans, p)
+		}
+	}
+
+	return humans
+}
+
+func (r *Room) quantityOfNPCs() int {
+	total := 0
+
+	for _, p := range r.players() {
+		if p.NPC {
+			total += 1
+		}
+	}
+
+	return total
+}
+
+func (r *Room) addBomb(bomb *Bomb) {
+	r.bombsMU.Lock()
+	defer r.bombsMU.Unlock()
+
+	r.Bombs = append(r.Bombs, bomb)
+}
+
+// removeBomb tira a bomba da sala e retorna a bomba removida (nil quando ela
+// já foi removida)
+func (r *Room) removeBomb(bomb *Bomb) *Bomb {
+	r.bombsMU.Lock()
+	defer r.bombsMU.Unlock()
+
+	for i, b := range r.Bombs {
+		if b.Id == bomb.Id {
+			r.Bombs = append(r.Bombs[:i], r.Bombs[i+1:]...)
+			return b
+		}
+	}
+
+	return nil
+}
+
+// bombs retorna cópias das bombas da sala; as bombas só são alteradas com
+// bombsMU travado (updateBomb)
+func (r *Room) bombs() []*Bomb {
+	r.bombsMU.Lock()
+	defer r.bombsMU.Unlock()
+
+	bombs := make([]*Bomb, 0, len(r.Bombs))
+
+	for _, b := range r.Bombs {
+		bomb := *b
+		bombs = append(bombs, &bomb)
+	}
+
+	return bombs
+}
+
+// updateBomb altera a bomba da sala com bombsMU travado e retorna uma cópia
+// atualizada; nil quando a bomba já foi removida ou update recusou a mudança
+func (r *Room) updateBomb(id string, update func(b *Bomb) bool) *Bomb {
+	r.bombsMU.Lock()
+	defer r.bombsMU.Unlock()
+
+	for _, b := range r.Bombs {
+		if b.Id == id {
+			if !update(b) {
+				return nil
+			}
+
+			bomb := *b
+			return &bomb
+		}
+	}
+
+	return nil
+}
+
+// audience retorna os players e os espectadores da sala
+func (r *Room) audience() []*Player {
+	return append(r.players(), r.spectators()...)
+}
+
+// broadcast envia a mensagem somente para os players e espectadores da sala
+func (r *Room) broadcast(v interface{}) {
+	r.record(ReplayOut, "", v)
+
+	for _, p := range r.audience() {
+		if err := p.write(v); err != nil {
+			logNet.Debug("Error on send command", "player", p.Id, "error", err)
+		}
+	}
+}
+
+// clearWorld remove os npcs, as bombas e os tiles alterados e deixa os
+// humanos fora do jogo; a sala recebe a previsão de perigo vazia
+func (r *Room) clearWorld() {
+	r.bombsMU.Lock()
+	r.Bombs = make([]*Bomb, 0)
+	r.bombsMU.Unlock()
+
+	r.broadcastDangerZones()
+
+	r.resetTiles()
+	r.resetHazards()
+
+	r.powerUpsMU.Lock()
+	r.PowerUps = make([]*PowerUp, 0)
+	r.powerUpsMU.Unlock()
+
+	for _, p := range r.players() {
+		p.Online = false
+
+		if p.NPC {
+			r.removePlayer(p)
+			r.broadcast(p.createPlayerRemovedMessage())
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var mapRotationList = flag.String("map-rotation", "", "comma separated list of maps in rotation (default: the default map)")
+var roundDuration = flag.Duration("round-duration", 5*time.Minute, "max duration of a round")
+var voteDuration = flag.Duration("vote-duration", 15*time.Second, "duration of the map vote intermission")
+
+type MapVoteStartMessage struct {
+	Type    string   `json:"type"`
+	Reason  string   `json:"reason"`
+	Options []string `json:"options"`
+	EndsAt  int64    `json:"endsAt"`
+}
+
+type MapVoteUpdateMessage struct {
+	Type  string         `json:"type"`
+	Votes map[string]int `json:"votes"`
+}
+
+type MapVoteResultMessage struct {
+	Type  string         `json:"type"`
+	Map   string         `json:"map"`
+	Votes map[string]int `json:"votes"`
+}
+
+type MapVoteInvalidMessage struct {
+	Type string `json:"type"`
+	Map  string `json:"map"`
+}
+
+// MapRotation guarda o mapa atual, a lista de rotação e a votação do próximo
+// mapa de uma sala
+type MapRotation struct {
+	mu   sync.Mutex
+	room *Room
+
+	Maps   []string
+	Index  int
+	Voting bool
+	Votes  map[string]string
+}
+
+// mapas da rotação configurada, copiados para cada sala nova
+var rotationMaps = []string{defaultMapName}
+
+func newMapRotation(room *Room) *MapRotation {
+	return &MapRotation{room: room, Maps: append([]string{}, rotationMaps...)}
+}
+
+func (r *MapRotation) currentMap() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Maps[r.Index]
+}
+
+// setupRotation valida a lista de mapas configurada contra os mapas carregados
+func setupRotation(list string) error {
+	names := []string{defaultMapName}
+
+	if list != "" {
+		names = make([]string, 0)
+
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+
+			if getMap(name) == nil {
+				return fmt.Errorf("map %q in rotation is not loaded", name)
+			}
+
+			names = append(names, name)
+		}
+	}
+
+	rotationMaps = names
+
+	return nil
+}
+
+// inRotation retorna true para o mapa padrão e os mapas da rotação configurada
+func inRotation(name string) bool {
+	if name == defaultMapName {
+		return true
+	}
+
+	for _, rotationMap := range rotationMaps {
+		if rotationMap == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// voteCount retorna a quantidade de votos de cada mapa
+func (r *MapRotation) voteCount() map[string]int {
+	votes := make(map[string]int)
+
+	for _, name := range r.Maps {
+		votes[name] = 0
+	}
+
+	for _, name := range r.Votes {
+		votes[name]++
+	}
+
+	return votes
+}
+
+func (r *MapRotation) vote(player *Player, name string) (map[string]int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.Voting {
+		return nil, false
+	}
+
+	valid := false
+
+	for _, option := range r.Maps {
+		if option == name {
+			valid = true
+		}
+	}
+
+	if !valid {
+		return nil, false
+	}
+
+	r.Votes[player.Id] = name
+
+	return r.voteCount(), true
+}
+
+// runMapVote abre a votação, aguarda o intervalo e retorna o mapa mais votado;
+// sem votos, ou empatado com o mais votado, vale o próximo da rotação. Com um
+// único mapa não há votação
+func (r *MapRotation) runMapVote(reason string) string {
+	r.mu.Lock()
+
+	if len(r.Maps) == 1 {
+		defer r.mu.Unlock()
+		return r.Maps[r.Index]
+	}
+
+	r.Voting = true
+	r.Votes = make(map[string]string)
+	options := append([]string{}, r.Maps...)
+	next := r.Maps[(r.Index+1)%len(r.Maps)]
+	r.mu.Unlock()
+
+	logGame.Info("Map vote started", "room", r.room.Code, "reason", reason, "options", options)
+
+	r.room.broadcast(MapVoteStartMessage{Type: "map-vote-start", Reason: reason, Options: options, EndsAt: getCurrentTimestamp() + voteDuration.Milliseconds()})
+
+	time.Sleep(*voteDuration)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	votes := r.voteCount()
+	winner := next
+
+	sort.Strings(options)
+
+	for _, name := range options {
+		if votes[name] > votes[winner] {
+			winner = name
+		}
+	}
+
+	for i, name := range r.Maps {
+		if name == winner {
+			r.Index = i
+		}
+	}
+
+	r.Voting = false
+	r.Votes = nil
+
+	logGame.Info("Map vote finished", "room", r.room.Code, "map", winner, "votes", votes)
+
+	r.room.broadcast(MapVoteResultMessage{Type: "map-vote-result", Map: winner, Votes: votes})
+
+	return winner
+}
+
+// changeMap remove os npcs e as bombas e move (revivendo) todos os players
+// da sala para o novo mapa
+func (r *Room) changeMap(mapName string) {
+	r.clearWorld()
+
+	if m := r.useMap(mapName); m != nil {
+		r.broadcast(createMapReloadedMessage(mapName, m))
+	}
+
+	humans := r.humans()
+
+	for _, p := range humans {
+		p.Map = mapName
+		p.Online = true
+
+		spawnPoint := r.selectSpawnPoint(mapName, p)
+		p.setTile(spawnPoint.X, spawnPoint.Y)
+
+		if err := p.send(p.createPlayerDataMessage()); err != nil {
+			logNet.Debug("Error on send command", "player", p.Id, "error", err)
+		}
+	}
+
+	for _, p := range humans {
+		for _, other := range humans {
+			if other.Id != p.Id {
+				if err := p.send(other.createPlayerAddedMessage()); err != nil {
+					logNet.Debug("Error on send command", "player", p.Id, "error", err)
+				}
+			}
+		}
+	}
+
+	r.placePowerUps(mapName)
+	r.sendSnapshots()
+
+	logGame.Info("Map changed", "room", r.Code, "map", mapName, "players", len(humans))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// o servidor só fica pronto depois que os mapas forem carregados
+var serverReady atomic.Bool
+
+// todas as conexões abertas, inclusive as que ainda não fizeram login
+var connections = make(map[*Player]bool)
+var connectionsMU sync.Mutex
+
+type ServerShutdownMessage struct {
+	Type           string `json:"type"`
+	ReconnectAfter int64  `json:"reconnectAfter"`
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !serverReady.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ready"))
+}
+
+// adminOnly exige o token de administração (Authorization: Bearer <token>);
+// sem -admin-token os endpoints ficam desativados
+func adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *adminToken == "" {
+			http.Error(w, "admin endpoints disabled", http.StatusForbidden)
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+			logHTTP.Warn("Unauthorized admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (p *Player) createServerShutdownMessage(reconnectAfter time.Duration) ServerShutdownMessage {
+	return ServerShutdownMessage{Type: "server-shutdown", ReconnectAfter: reconnectAfter.Milliseconds()}
+}
+
+func addConnection(p *Player) {
+	connectionsMU.Lock()
+	defer connectionsMU.Unlock()
+
+	connections[p] = true
+}
+
+func removeConnection(p *Player) {
+	connectionsMU.Lock()
+	defer connectionsMU.Unlock()
+
+	delete(connections, p)
+}
+
+func stopTickers() {
+	tickerBombs.Stop()
+	tickerHazards.Stop()
+	tickerAddNPC.Stop()
+}
+
+// disconnectPlayers avisa todas as conexões (com ou sem login) que o servidor
+// vai parar e fecha os sockets, respeitando o prazo do contexto
+func disconnectPlayers(ctx context.Context, reconnectAfter time.Duration) {
+	connectionsMU.Lock()
+	players := make([]*Player, 0, len(connections))
+
+	for p := range connections {
+		players = append(players, p)
+	}
+	connectionsMU.Unlock()
+
+	deadline, ok := ctx.Deadline()
+
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, p := range players {
+		if p.Socket == nil {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(p *Player) {
+			defer wg.Done()
+
+			p.Socket.SetWriteDeadline(deadline)
+
+			if err := p.send(p.createServerShutdownMessage(reconnectAfter)); err != nil {
+				logNet.Debug("Error on send command", "player", p.Id, "error", err)
+			}
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			if err := p.Socket.Close(); err != nil {
+				logNet.Debug("Error on close socket", "player", p.Id, "error", err)
+			}
+		}(p)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logNet.Info("All players disconnected", "players", len(players))
+	case <-ctx.Done():
+		logNet.Warn("Timeout while disconnecting players", "error", ctx.Err())
+	}
+}
+
+// shutdownServer para as rotinas do jogo, desconecta os players e encerra o
+// servidor http dentro do prazo configurado
+func shutdownServer(server *http.Server, timeout, reconnectAfter time.Duration) error {
+	serverReady.Store(false)
+	stopTickers()
+
+	for _, room := range listRooms() {
+		room.stopRecording()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	disconnectPlayers(ctx, reconnectAfter)
+
+	return server.Shutdown(ctx)
+}
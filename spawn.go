@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+)
+
+// tipo dos objetos do Tiled usados como ponto de spawn
+const spawnObjectType = "spawn"
+
+// spawnPoints retorna os tiles de spawn definidos no mapa que não estão bloqueados
+func (m *Map) spawnPoints() []Point {
+	points := make([]Point, 0)
+
+	for _, object := range m.objectsOfType(spawnObjectType) {
+		point := m.objectTile(object)
+
+		if m.isBlocking(point.X, point.Y) {
+			logMaps.Warn("Ignoring blocked spawn point", "object", object.Id, "x", point.X, "y", point.Y)
+			continue
+		}
+
+		points = append(points, point)
+	}
+
+	return points
+}
+
+// randomSpawnPoint sorteia um tile livre do mapa, usado quando o mapa não
+// define pontos de spawn
+func (r *Room) randomSpawnPoint(mapName string) Point {
+	m := r.getMap(mapName)
+
+	for {
+		x := r.randomInt(0, m.Meta.Width-1)
+		y := r.randomInt(0, m.Meta.Height-1)
+
+		if !r.isBlocking(mapName, x, y) {
+			return Point{X: x, Y: y}
+		}
+	}
+}
+
+// selectSpawnPoint escolhe o ponto de spawn do mapa mais distante dos inimigos
+// (colegas de time não contam) e das bombas ativas da sala
+func (r *Room) selectSpawnPoint(mapName string, player *Player) Point {
+	points := r.getMap(mapName).spawnPoints()
+
+	if len(points) == 0 {
+		return r.randomSpawnPoint(mapName)
+	}
+
+	threats := make([]Point, 0)
+
+	for _, p := range r.players() {
+		if teamsEnabled() && p.Team != 0 && p.Team == player.Team {
+			continue
+		}
+
+		if p.Id != player.Id && p.Online && p.Map == mapName {
+			threats = append(threats, Point{X: p.X, Y: p.Y})
+		}
+	}
+
+	for _, bomb := range r.bombs() {
+		if bomb.Map == mapName {
+			threats = append(threats, Point{X: bomb.X, Y: bomb.Y})
+		}
+	}
+
+	// sorteia entre os melhores pontos para não repetir sempre o mesmo
+	best := make([]Point, 0)
+	bestDistance := -1.0
+
+	for _, point := range points {
+		distance := math.Inf(1)
+
+		for _, threat := range threats {
+			distance = math.Min(distance, math.Hypot(float64(point.X-threat.X), float64(point.Y-threat.Y)))
+		}
+
+		if distance > bestDistance {
+			best = best[:0]
+			bestDistance = distance
+		}
+
+		if distance == bestDistance {
+			best = append(best, point)
+		}
+	}
+
+	return best[r.randomInt(0, len(best))]
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"time"
+)
+
+var spectatorSnapshotInterval = flag.Duration("spectator-snapshot-interval", 5*time.Second, "interval of the snapshots sent to spectators (0 disables)")
+
+var errSpectatorNotFound = errors.New("player-not-found")
+var errSpectator = errors.New("spectator")
+
+type SpectateSnapshotMessage struct {
+	Type      string              `json:"type"`
+	Code      string              `json:"code"`
+	Map       string              `json:"map"`
+	MapHash   string              `json:"mapHash"`
+	Following string              `json:"following"`
+	Players   []PlayerDataMessage `json:"players"`
+	Bombs     []BombAddedMessage  `json:"bombs"`
+	Tiles     []TileChange        `json:"tiles"`
+	Dangers   []DangerZone        `json:"dangers"`
+	PowerUps  []PowerUp           `json:"powerUps"`
+	Match     MatchStateMessage   `json:"match"`
+}
+
+type SpectateFollowingMessage struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+func (p *Player) createSpectateFollowingMessage() SpectateFollowingMessage {
+	return SpectateFollowingMessage{Type: "spectate-following", Id: p.Following}
+}
+
+// spectate coloca a conexão na sala como espectador: ela recebe todos os
+// eventos da sala sem ter um personagem no mapa
+func (r *Room) spectate(p *Player, follow string) error {
+	if p.Room != nil && !p.Room.Public {
+		return errRoomAlreadyJoined
+	}
+
+	if r.isClosed() {
+		return errRoomNotFound
+	}
+
+	p.leavePublicRoom()
+
+	p.Spectator = true
+	p.Online = false
+	p.Room = r
+
+	r.playersMU.Lock()
+	r.Spectators = append(r.Spectators, p)
+	r.playersMU.Unlock()
+
+	if follow != "" && r.findPlayer(follow) != nil {
+		p.Following = follow
+	}
+
+	logGame.Info("Spectator joined room", "room", r.Code, "player", p.Id, "following", p.Following)
+
+	if err := p.send(r.createSpectateSnapshotMessage(p)); err != nil {
+		logNet.Debug("Error on send command", "player", p.Id, "error", err)
+	}
+
+	r.broadcastLobbyState()
+
+	return nil
+}
+
+// stopSpectating tira o espectador da sala
+func (r *Room) stopSpectating(p *Player) {
+	r.playersMU.Lock()
+	for i, s := range r.Spectators {
+		if s.Id == p.Id {
+			r.Spectators = append(r.Spectators[:i], r.Spectators[i+1:]...)
+			break
+		}
+	}
+	r.playersMU.Unlock()
+
+	p.Room = nil
+	p.Spectator = false
+	p.Following = ""
+
+	logGame.Info("Spectator left room", "room", r.Code, "player", p.Id)
+
+	if !r.isClosed() {
+		r.broadcastLobbyState()
+	}
+}
+
+// follow troca o player acompanhado pelo espectador (vazio = câmera livre)
+func (r *Room) follow(p *Player, id string) error {
+	if id != "" && r.findPlayer(id) == nil {
+		return errSpectatorNotFound
+	}
+
+	p.Following = id
+
+	if err := p.send(p.createSpectateFollowingMessage()); err != nil {
+		logNet.Debug("Error on send command", "player", p.Id, "error", err)
+	}
+
+	return nil
+}
+
+// unfollow avisa os espectadores que acompanhavam um player que saiu
+func (r *Room) unfollow(id string) {
+	for _, s := range r.spectators() {
+		if s.Following == id {
+			s.Following = ""
+
+			if err := s.send(s.createSpectateFollowingMessage()); err != nil {
+				logNet.Debug("Error on send command", "player", s.Id, "error", err)
+			}
+		}
+	}
+}
+
+// endSpectating desconecta os espectadores da sala fechada
+func (r *Room) endSpectating() {
+	for _, s := range r.spectators() {
+		s.Room = nil
+		s.Spectator = false
+		s.Following = ""
+
+		if err := s.send(s.createSimpleMessage("spectate-ended")); err != nil {
+			logNet.Debug("Error on send command", "player", s.Id, "error", err)
+		}
+	}
+
+	r.playersMU.Lock()
+	r.Spectators = make([]*Player, 0)
+	r.playersMU.Unlock()
+}
+
+func (r *Room) findPlayer(id string) *Player {
+	for _, p := range r.players() {
+		if p.Id == id {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// spectators retorna uma cópia da lista de espectadores da sala
+func (r *Room) spectators() []*Player {
+	r.playersMU.Lock()
+	defer r.playersMU.Unlock()
+
+	spectators := make([]*Player, len(r.Spectators))
+	copy(spectators, r.Spectators)
+
+	return spectators
+}
+
+// createSpectateSnapshotMessage monta o estado completo da sala: players
+// vivos, bombas e a partida
+func (r *Room) createSpectateSnapshotMessage(spectator *Player) SpectateSnapshotMessage {
+	following := ""
+
+	if spectator != nil {
+		following = spectator.Following
+	}
+
+	mapName := r.Rotation.currentMap()
+	mapHash := ""
+
+	if m := r.getMap(mapName); m != nil {
+		mapHash = m.Hash
+	}
+
+	players := make([]PlayerDataMessage, 0)
+
+	for _, p := range r.players() {
+		if p.Online {
+			players = append(players, p.createPlayerAddedMessage())
+		}
+	}
+
+	bombs := make([]BombAddedMessage, 0)
+
+	for _, bomb := range r.bombs() {
+		bombs = append(bombs, createBombAddedMessage(bomb))
+	}
+
+	return SpectateSnapshotMessage{Type: "spectate-snapshot", Code: r.Code, Map: mapName, MapHash: mapHash, Following: following, Players: players, Bombs: bombs, Tiles: r.changedTiles(), Dangers: r.dangerZones(), PowerUps: r.powerUps(), Match: r.Match.createMatchStateMessage()}
+}
+
+// sendSnapshots envia o estado da sala para os espectadores e grava no replay
+func (r *Room) sendSnapshots() {
+	r.record(ReplayOut, "", r.createSpectateSnapshotMessage(nil))
+
+	for _, s := range r.spectators() {
+		if err := s.send(r.createSpectateSnapshotMessage(s)); err != nil {
+			logNet.Debug("Error on send command", "player", s.Id, "error", err)
+		}
+	}
+}
+
+// watchSpectators envia periodicamente o estado completo das salas para os
+// espectadores, corrigindo qualquer evento perdido
+func watchSpectators(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !serverReady.Load() {
+			return
+		}
+
+		for _, room := range listRooms() {
+			room.sendSnapshots()
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var suddenDeathAfter = flag.Duration("sudden-death-after", 0, "time of the round before the sudden death starts (0 disables)")
+var suddenDeathInterval = flag.Duration("sudden-death-interval", 250*time.Millisecond, "interval between the blocks falling in the sudden death")
+var suddenDeathTile = flag.Int("sudden-death-tile", 1, "tile id of the blocks falling in the sudden death")
+
+type TileChange struct {
+	X    int `json:"x"`
+	Y    int `json:"y"`
+	Tile int `json:"tile"`
+}
+
+type TilesChangedMessage struct {
+	Type  string       `json:"type"`
+	Map   string       `json:"map"`
+	Tiles []TileChange `json:"tiles"`
+}
+
+type SuddenDeathMessage struct {
+	Type     string `json:"type"`
+	Round    int    `json:"round"`
+	Map      string `json:"map"`
+	Interval int64  `json:"interval"`
+	Blocks   int    `json:"blocks"`
+}
+
+// isBlocking considera os tiles alterados na rodada da sala (blocos da morte
+// súbita e blocos destruídos) antes dos tiles do mapa
+func (r *Room) isBlocking(mapName string, x, y int) bool {
+	if r != nil {
+		r.tilesMU.Lock()
+		tile, ok := r.Tiles[Point{X: x, Y: y}]
+		r.tilesMU.Unlock()
+
+		if ok {
+			return tile > 0
+		}
+	}
+
+	return r.getMap(mapName).isBlocking(x, y)
+}
+
+// isWall retorna true para os tiles bloqueados que não podem ser destruídos
+// (paredes, pilares e blocos já derrubados)
+func (r *Room) isWall(mapName string, x, y int) bool {
+	return r.isBlocking(mapName, x, y) && !r.isDestructible(mapName, x, y)
+}
+
+func (r *Room) setTile(x, y, tile int) {
+	r.tilesMU.Lock()
+	defer r.tilesMU.Unlock()
+
+	r.Tiles[Point{X: x, Y: y}] = tile
+}
+
+// changedTiles retorna os tiles alterados na rodada
+func (r *Room) changedTiles() []TileChange {
+	r.tilesMU.Lock()
+	defer r.tilesMU.Unlock()
+
+	tiles := make([]TileChange, 0, len(r.Tiles))
+
+	for point, tile := range r.Tiles {
+		tiles = append(tiles, TileChange{X: point.X, Y: point.Y, Tile: tile})
+	}
+
+	return tiles
+}
+
+func (r *Room) resetTiles() {
+	r.tilesMU.Lock()
+	defer r.tilesMU.Unlock()
+
+	r.Tiles = make(map[Point]int)
+}
+
+// spiralPoints retorna os tiles do mapa em espiral, da borda para o centro
+func spiralPoints(width, height int) []Point {
+	points := make([]Point, 0, width*height)
+	left, top, right, bottom := 0, 0, width-1, height-1
+
+	for left <= right && top <= bottom {
+		for x := left; x <= right; x++ {
+			points = append(points, Point{X: x, Y: top})
+		}
+
+		for y := top + 1; y <= bottom; y++ {
+			points = append(points, Point{X: right, Y: y})
+		}
+
+		if top < bottom {
+			for x := right - 1; x >= left; x-- {
+				points = append(points, Point{X: x, Y: bottom})
+			}
+		}
+
+		if left < right {
+			for y := bottom - 1; y > top; y-- {
+				points = append(points, Point{X: left, Y: y})
+			}
+		}
+
+		left, top, right, bottom = left+1, top+1, right-1, bottom-1
+	}
+
+	return points
+}
+
+// suddenDeathDue retorna true quando a morte súbita da rodada deve começar
+func (m *Match) suddenDeathDue() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return *suddenDeathAfter > 0 && !m.SuddenDeath && getCurrentTimestamp()-m.RoundStartedAt >= suddenDeathAfter.Milliseconds()
+}
+
+// startSuddenDeath anuncia a morte súbita e começa a derrubar os blocos
+func (m *Match) startSuddenDeath() {
+	mapName := m.room.Rotation.currentMap()
+	mapMeta := m.room.getMap(mapName).Meta
+	points := spiralPoints(mapMeta.Width, mapMeta.Height)
+	blocks := 0
+
+	for _, point := range points {
+		if !m.room.isWall(mapName, point.X, point.Y) {
+			blocks++
+		}
+	}
+
+	m.mu.Lock()
+	m.SuddenDeath = true
+	round := m.Round
+	m.mu.Unlock()
+
+	logGame.Info("Sudden death started", "room", m.room.Code, "round", round, "map", mapName, "blocks", blocks)
+
+	m.room.broadcast(SuddenDeathMessage{Type: "sudden-death", Round: round, Map: mapName, Interval: suddenDeathInterval.Milliseconds(), Blocks: blocks})
+
+	go m.dropBlocks(round, mapName, points)
+}
+
+// dropBlocks derruba um bloco por intervalo, matando os players e destruindo
+// as bombas do tile, até o fim da rodada; os tiles são verificados na hora da
+// queda, já que os blocos destrutíveis podem ter sido destruídos (ou não)
+func (m *Match) dropBlocks(round int, mapName string, points []Point) {
+	for _, point := range points {
+		if m.room.isWall(mapName, point.X, point.Y) {
+			continue
+		}
+
+		time.Sleep(*suddenDeathInterval)
+
+		m.mu.Lock()
+		current := m.Round == round && m.State == MatchStatePlaying
+		m.mu.Unlock()
+
+		if !current || m.room.isClosed() {
+			return
+		}
+
+		m.room.setTile(point.X, point.Y, *suddenDeathTile)
+		m.room.broadcast(TilesChangedMessage{Type: "tiles-changed", Map: mapName, Tiles: []TileChange{{X: point.X, Y: point.Y, Tile: *suddenDeathTile}}})
+
+		bombs := m.room.bombs()
+
+		for _, bomb := range bombs {
+			if bomb.Map == mapName && bomb.X == point.X && bomb.Y == point.Y {
+				m.room.detonate(bomb)
+			}
+		}
+
+		// o bloco pode ter mudado o alcance das bombas
+		if len(bombs) > 0 {
+			m.room.broadcastDangerZones()
+		}
+
+		for _, p := range m.room.players() {
+			if p.Online && p.Map == mapName && p.X == point.X && p.Y == point.Y {
+				killPlayer(p, nil)
+			}
+		}
+	}
+}
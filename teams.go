@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var teamCount = flag.Int("teams", 0, "number of teams (0 = free for all)")
+var friendlyFire = flag.Bool("friendly-fire", false, "explosions hurt teammates in team mode")
+
+type TeamScoreMessage struct {
+	Type   string         `json:"type"`
+	Scores map[string]int `json:"scores"`
+}
+
+func teamsEnabled() bool {
+	return *teamCount > 1
+}
+
+// teamName retorna o id do time usado como vencedor e no placar
+func teamName(team int) string {
+	return fmt.Sprintf("team-%d", team)
+}
+
+// assignTeam retorna o time escolhido pelo player, se válido, ou o time com
+// menos players humanos na sala (npcs ficam sem time)
+func (r *Room) assignTeam(requested int) int {
+	if !teamsEnabled() {
+		return 0
+	}
+
+	if requested >= 1 && requested <= *teamCount {
+		return requested
+	}
+
+	counts := make([]int, *teamCount+1)
+
+	for _, p := range r.humans() {
+		if p.Team >= 1 && p.Team <= *teamCount {
+			counts[p.Team]++
+		}
+	}
+
+	team := 1
+
+	for t := 2; t <= *teamCount; t++ {
+		if counts[t] < counts[team] {
+			team = t
+		}
+	}
+
+	return team
+}
+
+// canDamage retorna false quando a explosão é de um colega de time e o fogo
+// amigo está desligado (a própria bomba sempre machuca)
+func canDamage(attacker, target *Player) bool {
+	if !teamsEnabled() || *friendlyFire || attacker == nil || attacker.Id == target.Id {
+		return true
+	}
+
+	return attacker.Team == 0 || attacker.Team != target.Team
+}
+
+// aliveTeams agrupa os players vivos por time
+func aliveTeams(alive []*Player) map[int][]*Player {
+	teams := make(map[int][]*Player)
+
+	for _, p := range alive {
+		teams[p.Team] = append(teams[p.Team], p)
+	}
+
+	return teams
+}
+
+// connectedTeams retorna a quantidade de times com players humanos na sala
+func (r *Room) connectedTeams() int {
+	teams := make(map[int]bool)
+
+	for _, p := range r.humans() {
+		teams[p.Team] = true
+	}
+
+	return len(teams)
+}
+
+// teamRoundResult é o roundResult do modo de times: vence o último time com
+// players vivos, ou no tempo esgotado o time com mais vivos (e depois mais abates)
+func teamRoundResult(alive []*Player, roundTeams int, timeUp bool) (string, string) {
+	teams := aliveTeams(alive)
+
+	if len(alive) == 0 {
+		return "all-players-dead", ""
+	}
+
+	if roundTeams > 1 && len(teams) == 1 {
+		return "last-team-standing", teamName(alive[0].Team)
+	}
+
+	if !timeUp {
+		return "", ""
+	}
+
+	ids := make([]int, 0, len(teams))
+
+	for team := range teams {
+		ids = append(ids, team)
+	}
+
+	sort.Ints(ids)
+
+	winner := ""
+	bestAlive := -1
+	bestKills := -1
+
+	for _, team := range ids {
+		kills := 0
+
+		for _, p := range teams[team] {
+			kills += p.Kills
+		}
+
+		if len(teams[team]) > bestAlive || (len(teams[team]) == bestAlive && kills > bestKills) {
+			winner = teamName(team)
+			bestAlive = len(teams[team])
+			bestKills = kills
+		} else if len(teams[team]) == bestAlive && kills == bestKills {
+			winner = ""
+		}
+	}
+
+	return "time-limit", winner
+}
+
+// scoreKill soma um ponto ao time do matador, ou tira um ponto quando ele
+// mata um colega de time
+func (m *Match) scoreKill(killer, victim *Player) {
+	if !teamsEnabled() || killer == nil || killer.Team == 0 || killer.Id == victim.Id {
+		return
+	}
+
+	m.mu.Lock()
+	if killer.Team == victim.Team {
+		m.TeamScores[teamName(killer.Team)]--
+	} else {
+		m.TeamScores[teamName(killer.Team)]++
+	}
+
+	scores := make(map[string]int)
+
+	for team, score := range m.TeamScores {
+		scores[team] = score
+	}
+	m.mu.Unlock()
+
+	m.room.broadcast(TeamScoreMessage{Type: "team-score", Scores: scores})
+}
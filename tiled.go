@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bits de flip usados pelo Tiled nos gids
+const tiledFlipFlags = 0xE0000000
+
+type MapProperty struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type,omitempty"`
+	Propertytype string      `json:"propertytype,omitempty"`
+	Value        interface{} `json:"value"`
+}
+
+type MapProperties []MapProperty
+
+func (properties MapProperties) get(name string) (interface{}, bool) {
+	for _, property := range properties {
+		if property.Name == name {
+			return property.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (properties MapProperties) getString(name, defaultValue string) string {
+	if value, ok := properties.get(name); ok {
+		if s, ok := value.(string); ok {
+			return s
+		}
+	}
+
+	return defaultValue
+}
+
+func (properties MapProperties) getFloat(name string, defaultValue float64) float64 {
+	if value, ok := properties.get(name); ok {
+		if f, ok := value.(float64); ok {
+			return f
+		}
+	}
+
+	return defaultValue
+}
+
+func (properties MapProperties) getInt(name string, defaultValue int) int {
+	return int(properties.getFloat(name, float64(defaultValue)))
+}
+
+func (properties MapProperties) getBool(name string, defaultValue bool) bool {
+	if value, ok := properties.get(name); ok {
+		if b, ok := value.(bool); ok {
+			return b
+		}
+	}
+
+	return defaultValue
+}
+
+type MapObject struct {
+	Id         int           `json:"id"`
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Class      string        `json:"class,omitempty"`
+	Gid        int           `json:"gid,omitempty"`
+	X          float64       `json:"x"`
+	Y          float64       `json:"y"`
+	Width      float64       `json:"width"`
+	Height     float64       `json:"height"`
+	Rotation   float64       `json:"rotation"`
+	Visible    bool          `json:"visible"`
+	Point      bool          `json:"point,omitempty"`
+	Ellipse    bool          `json:"ellipse,omitempty"`
+	Properties MapProperties `json:"properties,omitempty"`
+}
+
+// MapLayerData aceita os dados da layer como array de gids ou como string
+// base64 (opcionalmente comprimida); Tiles sempre guarda os gids decodificados
+type MapLayerData struct {
+	Tiles   []int
+	Encoded string
+}
+
+func (d *MapLayerData) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &d.Encoded)
+	}
+
+	return json.Unmarshal(b, &d.Tiles)
+}
+
+func (d MapLayerData) MarshalJSON() ([]byte, error) {
+	if d.Encoded != "" {
+		return json.Marshal(d.Encoded)
+	}
+
+	if d.Tiles == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(d.Tiles)
+}
+
+type MapChunk struct {
+	Data   MapLayerData `json:"data"`
+	Height int          `json:"height"`
+	Width  int          `json:"width"`
+	X      int          `json:"x"`
+	Y      int          `json:"y"`
+}
+
+type MapLayer struct {
+	Id          int           `json:"id,omitempty"`
+	Chunks      []MapChunk    `json:"chunks,omitempty"`
+	Compression string        `json:"compression,omitempty"`
+	Data        *MapLayerData `json:"data,omitempty"`
+	Encoding    string        `json:"encoding,omitempty"`
+	Draworder   string        `json:"draworder,omitempty"`
+	Height      int           `json:"height"`
+	Layers      []MapLayer    `json:"layers,omitempty"`
+	Name        string        `json:"name"`
+	Objects     []MapObject   `json:"objects,omitempty"`
+	Offsetx     float64       `json:"offsetx,omitempty"`
+	Offsety     float64       `json:"offsety,omitempty"`
+	Opacity     float64       `json:"opacity"`
+	Properties  MapProperties `json:"properties,omitempty"`
+	Startx      int           `json:"startx,omitempty"`
+	Starty      int           `json:"starty,omitempty"`
+	Type        string        `json:"type"`
+	Visible     bool          `json:"visible"`
+	Width       int           `json:"width"`
+	X           int           `json:"x"`
+	Y           int           `json:"y"`
+}
+
+type MapTile struct {
+	Id         int           `json:"id"`
+	Type       string        `json:"type,omitempty"`
+	Class      string        `json:"class,omitempty"`
+	Properties MapProperties `json:"properties,omitempty"`
+}
+
+type MapTileset struct {
+	Columns     int           `json:"columns"`
+	Firstgid    int           `json:"firstgid"`
+	Image       string        `json:"image"`
+	Imageheight int           `json:"imageheight"`
+	Imagewidth  int           `json:"imagewidth"`
+	Margin      int           `json:"margin"`
+	Name        string        `json:"name"`
+	Properties  MapProperties `json:"properties,omitempty"`
+	Source      string        `json:"source,omitempty"`
+	Spacing     int           `json:"spacing"`
+	Tilecount   int           `json:"tilecount"`
+	Tileheight  int           `json:"tileheight"`
+	Tiles       []MapTile     `json:"tiles,omitempty"`
+	Tilewidth   int           `json:"tilewidth"`
+}
+
+type Map struct {
+	Height       int             `json:"height"`
+	Infinite     bool            `json:"infinite"`
+	Layers       []MapLayer      `json:"layers"`
+	Nextlayerid  int             `json:"nextlayerid,omitempty"`
+	Nextobjectid int             `json:"nextobjectid"`
+	Orientation  string          `json:"orientation"`
+	Properties   MapProperties   `json:"properties,omitempty"`
+	Renderorder  string          `json:"renderorder"`
+	Tiledversion string          `json:"tiledversion,omitempty"`
+	Tileheight   int             `json:"tileheight"`
+	Tilesets     []MapTileset    `json:"tilesets"`
+	Tilewidth    int             `json:"tilewidth"`
+	Type         string          `json:"type,omitempty"`
+	Version      json.RawMessage `json:"version,omitempty"`
+	Width        int             `json:"width"`
+
+	// layer usada para colisão
+	Meta *MapLayer `json:"-"`
+
+	// configuração das bombas de perigo, lida das propriedades do mapa
+	Hazards HazardConfig `json:"-"`
+
+	// conteúdo do arquivo e seu hash (sha256), enviados aos clientes
+	Raw  []byte `json:"-"`
+	Hash string `json:"-"`
+}
+
+// tiles retorna os gids da layer (vazio para layers sem dados)
+func (layer *MapLayer) tiles() []int {
+	if layer.Data == nil {
+		return nil
+	}
+
+	return layer.Data.Tiles
+}
+
+// allLayers retorna as layers do mapa, incluindo as que estão dentro de grupos
+func (m *Map) allLayers() []*MapLayer {
+	var result []*MapLayer
+	var walk func(layers []MapLayer)
+
+	walk = func(layers []MapLayer) {
+		for i := range layers {
+			result = append(result, &layers[i])
+
+			if layers[i].Type == "group" {
+				walk(layers[i].Layers)
+			}
+		}
+	}
+
+	walk(m.Layers)
+
+	return result
+}
+
+// objectsOfType retorna os objetos de todas as object layers com o tipo desejado
+func (m *Map) objectsOfType(objectType string) []MapObject {
+	result := make([]MapObject, 0)
+
+	for _, layer := range m.allLayers() {
+		if layer.Type != "objectgroup" {
+			continue
+		}
+
+		for _, object := range layer.Objects {
+			if object.Type == objectType {
+				result = append(result, object)
+			}
+		}
+	}
+
+	return result
+}
+
+// objectTile converte a posição do objeto (em pixels) para o tile do centro
+func (m *Map) objectTile(object MapObject) Point {
+	x := object.X + object.Width/2
+	y := object.Y + object.Height/2
+
+	// objetos de tile são ancorados no canto inferior esquerdo
+	if object.Gid > 0 {
+		y = object.Y - object.Height/2
+	}
+
+	return Point{
+		X: int(math.Floor(x / float64(m.Tilewidth))),
+		Y: int(math.Floor(y / float64(m.Tileheight))),
+	}
+}
+
+func (m *Map) tileProperties(gid int) MapProperties {
+	gid = gid &^ tiledFlipFlags
+	tileset := m.tilesetForGid(gid)
+
+	if tileset == nil {
+		return nil
+	}
+
+	for _, tile := range tileset.Tiles {
+		if tile.Id == gid-tileset.Firstgid {
+			return tile.Properties
+		}
+	}
+
+	return nil
+}
+
+func (m *Map) tilesetForGid(gid int) *MapTileset {
+	gid = gid &^ tiledFlipFlags
+
+	for i := range m.Tilesets {
+		tileset := &m.Tilesets[i]
+
+		if gid >= tileset.Firstgid && gid < tileset.Firstgid+tileset.Tilecount {
+			return tileset
+		}
+	}
+
+	return nil
+}
+
+// decodeLayerData converte os dados base64 (com compressão zlib ou gzip) em gids
+func decodeLayerData(data *MapLayerData, encoding, compression string) error {
+	if data.Encoded == "" {
+		return nil
+	}
+
+	if encoding != "base64" {
+		return fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data.Encoded))
+
+	if err != nil {
+		return fmt.Errorf("invalid base64 data: %w", err)
+	}
+
+	var reader io.Reader
+
+	switch compression {
+	case "":
+		reader = bytes.NewReader(raw)
+	case "zlib":
+		reader, err = zlib.NewReader(bytes.NewReader(raw))
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(raw))
+	default:
+		return fmt.Errorf("unsupported compression %q", compression)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s data: %w", compression, err)
+	}
+
+	decompressed, err := io.ReadAll(reader)
+
+	if err != nil {
+		return fmt.Errorf("invalid %s data: %w", compression, err)
+	}
+
+	if len(decompressed)%4 != 0 {
+		return fmt.Errorf("invalid data length %d", len(decompressed))
+	}
+
+	data.Tiles = make([]int, len(decompressed)/4)
+
+	for i := range data.Tiles {
+		data.Tiles[i] = int(binary.LittleEndian.Uint32(decompressed[i*4:]))
+	}
+
+	data.Encoded = ""
+
+	return nil
+}
+
+// normalize decodifica os dados das layers, monta as layers infinitas a partir
+// dos chunks, carrega tilesets externos e unifica type/class dos objetos
+func (m *Map) normalize(mapFile string) error {
+	for i := range m.Tilesets {
+		if m.Tilesets[i].Source == "" {
+			continue
+		}
+
+		if err := loadExternalTileset(&m.Tilesets[i], filepath.Join(filepath.Dir(mapFile), m.Tilesets[i].Source)); err != nil {
+			return fmt.Errorf("tileset %q: %w", m.Tilesets[i].Source, err)
+		}
+	}
+
+	for i := range m.Tilesets {
+		for j := range m.Tilesets[i].Tiles {
+			tile := &m.Tilesets[i].Tiles[j]
+
+			if tile.Type == "" {
+				tile.Type = tile.Class
+			}
+		}
+	}
+
+	layers := m.allLayers()
+
+	// limites dos chunks de todas as layers (mapas infinitos)
+	minX, minY, maxX, maxY := math.MaxInt, math.MaxInt, math.MinInt, math.MinInt
+
+	for _, layer := range layers {
+		if layer.Data != nil {
+			if err := decodeLayerData(layer.Data, layer.Encoding, layer.Compression); err != nil {
+				return fmt.Errorf("layer %q: %w", layer.Name, err)
+			}
+		}
+
+		for j := range layer.Chunks {
+			chunk := &layer.Chunks[j]
+
+			if err := decodeLayerData(&chunk.Data, layer.Encoding, layer.Compression); err != nil {
+				return fmt.Errorf("layer %q: chunk %d,%d: %w", layer.Name, chunk.X, chunk.Y, err)
+			}
+
+			if len(chunk.Data.Tiles) != chunk.Width*chunk.Height {
+				return fmt.Errorf("layer %q: chunk %d,%d: data length %d does not match %dx%d", layer.Name, chunk.X, chunk.Y, len(chunk.Data.Tiles), chunk.Width, chunk.Height)
+			}
+
+			minX = min(minX, chunk.X)
+			minY = min(minY, chunk.Y)
+			maxX = max(maxX, chunk.X+chunk.Width)
+			maxY = max(maxY, chunk.Y+chunk.Height)
+		}
+
+		layer.Encoding = ""
+		layer.Compression = ""
+
+		for j := range layer.Objects {
+			object := &layer.Objects[j]
+
+			if object.Type == "" {
+				object.Type = object.Class
+			}
+		}
+	}
+
+	if !m.Infinite {
+		return nil
+	}
+
+	if minX > maxX {
+		return fmt.Errorf("infinite map without chunks")
+	}
+
+	// converte o mapa infinito em um mapa finito com os limites dos chunks; os
+	// objetos são deslocados para a nova origem (os chunks podem ser negativos)
+	m.Infinite = false
+	m.Width = maxX - minX
+	m.Height = maxY - minY
+
+	for _, layer := range layers {
+		for j := range layer.Objects {
+			layer.Objects[j].X -= float64(minX * m.Tilewidth)
+			layer.Objects[j].Y -= float64(minY * m.Tileheight)
+		}
+
+		if layer.Type != "tilelayer" {
+			continue
+		}
+
+		tiles := make([]int, m.Width*m.Height)
+
+		for _, chunk := range layer.Chunks {
+			for y := 0; y < chunk.Height; y++ {
+				for x := 0; x < chunk.Width; x++ {
+					tiles[(chunk.X-minX+x)+(chunk.Y-minY+y)*m.Width] = chunk.Data.Tiles[x+y*chunk.Width]
+				}
+			}
+		}
+
+		layer.Chunks = nil
+		layer.Data = &MapLayerData{Tiles: tiles}
+		layer.Width = m.Width
+		layer.Height = m.Height
+		layer.Startx = 0
+		layer.Starty = 0
+	}
+
+	return nil
+}
+
+// loadExternalTileset carrega um tileset externo (.tsx ou .json/.tsj),
+// mantendo o firstgid definido no mapa
+func loadExternalTileset(tileset *MapTileset, tilesetFile string) error {
+	file, err := os.ReadFile(tilesetFile)
+
+	if err != nil {
+		return err
+	}
+
+	var external MapTileset
+
+	if strings.EqualFold(filepath.Ext(tilesetFile), ".tsx") {
+		external, err = decodeTSX(file)
+	} else {
+		err = json.Unmarshal(file, &external)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid tileset: %w", err)
+	}
+
+	external.Firstgid = tileset.Firstgid
+	external.Source = ""
+	*tileset = external
+
+	return nil
+}
+
+// parseMap decodifica um mapa do Tiled em json ou tmx
+func parseMap(mapFile string, file []byte) (*Map, error) {
+	var m Map
+
+	if strings.EqualFold(filepath.Ext(mapFile), ".tmx") {
+		converted, err := decodeTMX(file)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid tmx: %w", err)
+		}
+
+		m = *converted
+	} else if err := json.Unmarshal(file, &m); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	if err := m.normalize(mapFile); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
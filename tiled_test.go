@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// encodeGids monta os dados base64 de uma layer como o Tiled grava
+func encodeGids(t *testing.T, gids []int, compression string) string {
+	t.Helper()
+
+	raw := make([]byte, len(gids)*4)
+
+	for i, gid := range gids {
+		binary.LittleEndian.PutUint32(raw[i*4:], uint32(gid))
+	}
+
+	var buffer bytes.Buffer
+
+	switch compression {
+	case "":
+		buffer.Write(raw)
+	case "zlib":
+		writer := zlib.NewWriter(&buffer)
+		writer.Write(raw)
+		writer.Close()
+	case "gzip":
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(raw)
+		writer.Close()
+	}
+
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func TestDecodeLayerData(t *testing.T) {
+	gids := []int{0, 1, 2, 76, 108, 0x80000001}
+
+	tests := []struct {
+		name        string
+		data        MapLayerData
+		encoding    string
+		compression string
+		want        []int
+		wantErr     bool
+	}{
+		{name: "array", data: MapLayerData{Tiles: []int{1, 2}}, want: []int{1, 2}},
+		{name: "base64", data: MapLayerData{Encoded: encodeGids(t, gids, "")}, encoding: "base64", want: gids},
+		{name: "base64 zlib", data: MapLayerData{Encoded: encodeGids(t, gids, "zlib")}, encoding: "base64", compression: "zlib", want: gids},
+		{name: "base64 gzip", data: MapLayerData{Encoded: encodeGids(t, gids, "gzip")}, encoding: "base64", compression: "gzip", want: gids},
+		{name: "base64 with spaces", data: MapLayerData{Encoded: "\n  " + encodeGids(t, gids, "zlib") + "\n"}, encoding: "base64", compression: "zlib", want: gids},
+		{name: "unsupported encoding", data: MapLayerData{Encoded: "AAAA"}, encoding: "hex", wantErr: true},
+		{name: "unsupported compression", data: MapLayerData{Encoded: encodeGids(t, gids, "")}, encoding: "base64", compression: "zstd", wantErr: true},
+		{name: "invalid base64", data: MapLayerData{Encoded: "!!!"}, encoding: "base64", wantErr: true},
+		{name: "invalid zlib", data: MapLayerData{Encoded: encodeGids(t, gids, "")}, encoding: "base64", compression: "zlib", wantErr: true},
+		{name: "invalid length", data: MapLayerData{Encoded: base64.StdEncoding.EncodeToString([]byte{1, 0, 0})}, encoding: "base64", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data
+			err := decodeLayerData(&data, test.encoding, test.compression)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got tiles %v", data.Tiles)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(data.Tiles, test.want) {
+				t.Errorf("tiles = %v, want %v", data.Tiles, test.want)
+			}
+
+			if data.Encoded != "" {
+				t.Errorf("encoded data not cleared")
+			}
+		})
+	}
+}
+
+func TestNormalizeInfinite(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []MapChunk
+		objects       []MapObject
+		width, height int
+		want          []int
+		wantObjects   []MapObject
+		wantErr       bool
+	}{
+		{
+			name:   "single negative chunk",
+			chunks: []MapChunk{{X: -2, Y: -1, Width: 2, Height: 2, Data: MapLayerData{Tiles: []int{1, 2, 3, 4}}}},
+			width:  2, height: 2,
+			want: []int{1, 2, 3, 4},
+		},
+		{
+			name: "chunks side by side",
+			chunks: []MapChunk{
+				{X: -2, Y: 0, Width: 2, Height: 1, Data: MapLayerData{Tiles: []int{1, 2}}},
+				{X: 0, Y: 0, Width: 2, Height: 1, Data: MapLayerData{Tiles: []int{3, 4}}},
+			},
+			width: 4, height: 1,
+			want: []int{1, 2, 3, 4},
+		},
+		{
+			name: "gap between chunks is empty",
+			chunks: []MapChunk{
+				{X: 0, Y: 0, Width: 1, Height: 1, Data: MapLayerData{Tiles: []int{5}}},
+				{X: 2, Y: 1, Width: 1, Height: 1, Data: MapLayerData{Tiles: []int{6}}},
+			},
+			width: 3, height: 2,
+			want: []int{5, 0, 0, 0, 0, 6},
+		},
+		{
+			name:    "objects follow the origin",
+			chunks:  []MapChunk{{X: -1, Y: -2, Width: 2, Height: 2, Data: MapLayerData{Tiles: []int{1, 0, 0, 1}}}},
+			objects: []MapObject{{Id: 1, X: -32, Y: -32, Width: 32, Height: 32}},
+			width:   2, height: 2,
+			want:        []int{1, 0, 0, 1},
+			wantObjects: []MapObject{{Id: 1, X: 0, Y: 32, Width: 32, Height: 32}},
+		},
+		{
+			name:    "chunk with wrong data length",
+			chunks:  []MapChunk{{X: 0, Y: 0, Width: 2, Height: 2, Data: MapLayerData{Tiles: []int{1}}}},
+			wantErr: true,
+		},
+		{
+			name:    "no chunks",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &Map{
+				Infinite:   true,
+				Tilewidth:  32,
+				Tileheight: 32,
+				Layers: []MapLayer{
+					{Name: "Meta", Type: "tilelayer", Chunks: test.chunks},
+					{Name: "Objects", Type: "objectgroup", Objects: test.objects},
+				},
+			}
+
+			err := m.normalize("maps/test.json")
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if m.Infinite || m.Width != test.width || m.Height != test.height {
+				t.Fatalf("map = infinite %v %dx%d, want finite %dx%d", m.Infinite, m.Width, m.Height, test.width, test.height)
+			}
+
+			layer := m.Layers[0]
+
+			if layer.Chunks != nil || layer.Width != test.width || layer.Height != test.height {
+				t.Fatalf("layer not converted: %d chunks, %dx%d", len(layer.Chunks), layer.Width, layer.Height)
+			}
+
+			if !reflect.DeepEqual(layer.Data.Tiles, test.want) {
+				t.Errorf("tiles = %v, want %v", layer.Data.Tiles, test.want)
+			}
+
+			if test.wantObjects != nil && !reflect.DeepEqual(m.Layers[1].Objects, test.wantObjects) {
+				t.Errorf("objects = %+v, want %+v", m.Layers[1].Objects, test.wantObjects)
+			}
+		})
+	}
+}
+
+func TestNormalizeEncodedLayers(t *testing.T) {
+	gids := []int{1, 0, 2, 3}
+
+	m := &Map{
+		Width:  2,
+		Height: 2,
+		Layers: []MapLayer{
+			{Name: "Meta", Type: "tilelayer", Width: 2, Height: 2, Encoding: "base64", Compression: "gzip", Data: &MapLayerData{Encoded: encodeGids(t, gids, "gzip")}},
+			{Name: "Group", Type: "group", Layers: []MapLayer{
+				{Name: "Floor", Type: "tilelayer", Width: 2, Height: 2, Encoding: "base64", Compression: "zlib", Data: &MapLayerData{Encoded: encodeGids(t, gids, "zlib")}},
+			}},
+		},
+	}
+
+	if err := m.normalize("maps/test.json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, layer := range m.allLayers() {
+		if layer.Type != "tilelayer" {
+			continue
+		}
+
+		if !reflect.DeepEqual(layer.tiles(), gids) {
+			t.Errorf("layer %q: tiles = %v, want %v", layer.Name, layer.tiles(), gids)
+		}
+
+		if layer.Encoding != "" || layer.Compression != "" {
+			t.Errorf("layer %q: encoding %q and compression %q not cleared", layer.Name, layer.Encoding, layer.Compression)
+		}
+	}
+}
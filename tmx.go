@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// estruturas do formato xml (tmx/tsx) do Tiled, convertidas para as mesmas
+// estruturas usadas pelos mapas em json
+
+type tmxProperty struct {
+	Name         string `xml:"name,attr"`
+	Type         string `xml:"type,attr"`
+	Propertytype string `xml:"propertytype,attr"`
+	Value        string `xml:"value,attr"`
+	Text         string `xml:",chardata"`
+}
+
+type tmxTile struct {
+	Id         int           `xml:"id,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxTileset struct {
+	Firstgid   int           `xml:"firstgid,attr"`
+	Source     string        `xml:"source,attr"`
+	Name       string        `xml:"name,attr"`
+	Tilewidth  int           `xml:"tilewidth,attr"`
+	Tileheight int           `xml:"tileheight,attr"`
+	Spacing    int           `xml:"spacing,attr"`
+	Margin     int           `xml:"margin,attr"`
+	Tilecount  int           `xml:"tilecount,attr"`
+	Columns    int           `xml:"columns,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Image      struct {
+		Source string `xml:"source,attr"`
+		Width  int    `xml:"width,attr"`
+		Height int    `xml:"height,attr"`
+	} `xml:"image"`
+	Tiles []tmxTile `xml:"tile"`
+}
+
+type tmxChunk struct {
+	X      int    `xml:"x,attr"`
+	Y      int    `xml:"y,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	Text   string `xml:",chardata"`
+	Tiles  []struct {
+		Gid int `xml:"gid,attr"`
+	} `xml:"tile"`
+}
+
+type tmxData struct {
+	Encoding    string     `xml:"encoding,attr"`
+	Compression string     `xml:"compression,attr"`
+	Text        string     `xml:",chardata"`
+	Chunks      []tmxChunk `xml:"chunk"`
+	Tiles       []struct {
+		Gid int `xml:"gid,attr"`
+	} `xml:"tile"`
+}
+
+type tmxObject struct {
+	Id         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	Gid        int           `xml:"gid,attr"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Width      float64       `xml:"width,attr"`
+	Height     float64       `xml:"height,attr"`
+	Rotation   float64       `xml:"rotation,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Point      *struct{}     `xml:"point"`
+	Ellipse    *struct{}     `xml:"ellipse"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+// tmxLayer representa layer, objectgroup, imagelayer ou group (pelo XMLName)
+type tmxLayer struct {
+	XMLName    xml.Name
+	Id         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Width      int           `xml:"width,attr"`
+	Height     int           `xml:"height,attr"`
+	Opacity    *float64      `xml:"opacity,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Offsetx    float64       `xml:"offsetx,attr"`
+	Offsety    float64       `xml:"offsety,attr"`
+	Draworder  string        `xml:"draworder,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Data       *tmxData      `xml:"data"`
+	Objects    []tmxObject   `xml:"object"`
+	Layers     []tmxLayer    `xml:",any"`
+}
+
+type tmxMap struct {
+	XMLName      xml.Name      `xml:"map"`
+	Version      string        `xml:"version,attr"`
+	Tiledversion string        `xml:"tiledversion,attr"`
+	Orientation  string        `xml:"orientation,attr"`
+	Renderorder  string        `xml:"renderorder,attr"`
+	Width        int           `xml:"width,attr"`
+	Height       int           `xml:"height,attr"`
+	Tilewidth    int           `xml:"tilewidth,attr"`
+	Tileheight   int           `xml:"tileheight,attr"`
+	Infinite     int           `xml:"infinite,attr"`
+	Nextlayerid  int           `xml:"nextlayerid,attr"`
+	Nextobjectid int           `xml:"nextobjectid,attr"`
+	Properties   []tmxProperty `xml:"properties>property"`
+	Tilesets     []tmxTileset  `xml:"tileset"`
+	Layers       []tmxLayer    `xml:",any"`
+}
+
+func convertTMXProperties(properties []tmxProperty) (MapProperties, error) {
+	if len(properties) == 0 {
+		return nil, nil
+	}
+
+	result := make(MapProperties, 0, len(properties))
+
+	for _, property := range properties {
+		text := property.Value
+
+		if text == "" {
+			text = property.Text
+		}
+
+		var value interface{} = text
+		var err error
+
+		switch property.Type {
+		case "int", "float", "object":
+			value, err = strconv.ParseFloat(text, 64)
+		case "bool":
+			value, err = strconv.ParseBool(text)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("property %q: invalid %s value %q", property.Name, property.Type, text)
+		}
+
+		propertyType := property.Type
+
+		if propertyType == "" {
+			propertyType = "string"
+		}
+
+		result = append(result, MapProperty{Name: property.Name, Type: propertyType, Propertytype: property.Propertytype, Value: value})
+	}
+
+	return result, nil
+}
+
+// parseTMXData converte os dados csv, xml ou base64 de uma layer ou chunk
+func parseTMXData(encoding, text string, tiles []struct {
+	Gid int `xml:"gid,attr"`
+}) (MapLayerData, error) {
+	var data MapLayerData
+
+	switch encoding {
+	case "":
+		data.Tiles = make([]int, len(tiles))
+
+		for i, tile := range tiles {
+			data.Tiles[i] = tile.Gid
+		}
+	case "csv":
+		for _, value := range strings.Split(text, ",") {
+			value = strings.TrimSpace(value)
+
+			if value == "" {
+				continue
+			}
+
+			gid, err := strconv.ParseUint(value, 10, 32)
+
+			if err != nil {
+				return data, fmt.Errorf("invalid csv gid %q", value)
+			}
+
+			data.Tiles = append(data.Tiles, int(gid))
+		}
+	case "base64":
+		data.Encoded = strings.TrimSpace(text)
+	default:
+		return data, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	return data, nil
+}
+
+func convertTMXTileset(tileset tmxTileset) (MapTileset, error) {
+	result := MapTileset{
+		Columns:     tileset.Columns,
+		Firstgid:    tileset.Firstgid,
+		Image:       tileset.Image.Source,
+		Imageheight: tileset.Image.Height,
+		Imagewidth:  tileset.Image.Width,
+		Margin:      tileset.Margin,
+		Name:        tileset.Name,
+		Source:      tileset.Source,
+		Spacing:     tileset.Spacing,
+		Tilecount:   tileset.Tilecount,
+		Tileheight:  tileset.Tileheight,
+		Tilewidth:   tileset.Tilewidth,
+	}
+
+	var err error
+
+	if result.Properties, err = convertTMXProperties(tileset.Properties); err != nil {
+		return result, err
+	}
+
+	for _, tile := range tileset.Tiles {
+		properties, err := convertTMXProperties(tile.Properties)
+
+		if err != nil {
+			return result, fmt.Errorf("tile %d: %w", tile.Id, err)
+		}
+
+		result.Tiles = append(result.Tiles, MapTile{Id: tile.Id, Type: tile.Type, Class: tile.Class, Properties: properties})
+	}
+
+	return result, nil
+}
+
+func convertTMXLayer(layer tmxLayer) (MapLayer, error) {
+	result := MapLayer{
+		Id:        layer.Id,
+		Name:      layer.Name,
+		Width:     layer.Width,
+		Height:    layer.Height,
+		Opacity:   1,
+		Visible:   layer.Visible == nil || *layer.Visible != 0,
+		Offsetx:   layer.Offsetx,
+		Offsety:   layer.Offsety,
+		Draworder: layer.Draworder,
+	}
+
+	if layer.Opacity != nil {
+		result.Opacity = *layer.Opacity
+	}
+
+	var err error
+
+	if result.Properties, err = convertTMXProperties(layer.Properties); err != nil {
+		return result, fmt.Errorf("layer %q: %w", layer.Name, err)
+	}
+
+	switch layer.XMLName.Local {
+	case "layer":
+		result.Type = "tilelayer"
+
+		if layer.Data == nil {
+			return result, fmt.Errorf("layer %q: missing data", layer.Name)
+		}
+
+		result.Encoding = layer.Data.Encoding
+		result.Compression = layer.Data.Compression
+
+		data, err := parseTMXData(layer.Data.Encoding, layer.Data.Text, layer.Data.Tiles)
+
+		if err != nil {
+			return result, fmt.Errorf("layer %q: %w", layer.Name, err)
+		}
+
+		result.Data = &data
+
+		for _, chunk := range layer.Data.Chunks {
+			data, err := parseTMXData(layer.Data.Encoding, chunk.Text, chunk.Tiles)
+
+			if err != nil {
+				return result, fmt.Errorf("layer %q: chunk %d,%d: %w", layer.Name, chunk.X, chunk.Y, err)
+			}
+
+			result.Chunks = append(result.Chunks, MapChunk{Data: data, X: chunk.X, Y: chunk.Y, Width: chunk.Width, Height: chunk.Height})
+		}
+	case "objectgroup":
+		result.Type = "objectgroup"
+
+		for _, object := range layer.Objects {
+			properties, err := convertTMXProperties(object.Properties)
+
+			if err != nil {
+				return result, fmt.Errorf("layer %q: object %d: %w", layer.Name, object.Id, err)
+			}
+
+			result.Objects = append(result.Objects, MapObject{
+				Id:         object.Id,
+				Name:       object.Name,
+				Type:       object.Type,
+				Class:      object.Class,
+				Gid:        object.Gid,
+				X:          object.X,
+				Y:          object.Y,
+				Width:      object.Width,
+				Height:     object.Height,
+				Rotation:   object.Rotation,
+				Visible:    object.Visible == nil || *object.Visible != 0,
+				Point:      object.Point != nil,
+				Ellipse:    object.Ellipse != nil,
+				Properties: properties,
+			})
+		}
+	case "imagelayer":
+		result.Type = "imagelayer"
+	case "group":
+		result.Type = "group"
+
+		for _, child := range layer.Layers {
+			if !isTMXLayer(child) {
+				continue
+			}
+
+			converted, err := convertTMXLayer(child)
+
+			if err != nil {
+				return result, err
+			}
+
+			result.Layers = append(result.Layers, converted)
+		}
+	}
+
+	return result, nil
+}
+
+func isTMXLayer(layer tmxLayer) bool {
+	switch layer.XMLName.Local {
+	case "layer", "objectgroup", "imagelayer", "group":
+		return true
+	}
+
+	return false
+}
+
+func decodeTMX(file []byte) (*Map, error) {
+	var source tmxMap
+
+	if err := xml.Unmarshal(file, &source); err != nil {
+		return nil, err
+	}
+
+	m := &Map{
+		Height:       source.Height,
+		Infinite:     source.Infinite != 0,
+		Nextlayerid:  source.Nextlayerid,
+		Nextobjectid: source.Nextobjectid,
+		Orientation:  source.Orientation,
+		Renderorder:  source.Renderorder,
+		Tiledversion: source.Tiledversion,
+		Tileheight:   source.Tileheight,
+		Tilewidth:    source.Tilewidth,
+		Type:         "map",
+		Version:      []byte(strconv.Quote(source.Version)),
+		Width:        source.Width,
+	}
+
+	var err error
+
+	if m.Properties, err = convertTMXProperties(source.Properties); err != nil {
+		return nil, err
+	}
+
+	for _, tileset := range source.Tilesets {
+		converted, err := convertTMXTileset(tileset)
+
+		if err != nil {
+			return nil, fmt.Errorf("tileset %q: %w", tileset.Name, err)
+		}
+
+		m.Tilesets = append(m.Tilesets, converted)
+	}
+
+	for _, layer := range source.Layers {
+		if !isTMXLayer(layer) {
+			continue
+		}
+
+		converted, err := convertTMXLayer(layer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.Layers = append(m.Layers, converted)
+	}
+
+	return m, nil
+}
+
+func decodeTSX(file []byte) (MapTileset, error) {
+	var source tmxTileset
+
+	if err := xml.Unmarshal(file, &source); err != nil {
+		return MapTileset{}, err
+	}
+
+	return convertTMXTileset(source)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type tmxGids = []struct {
+	Gid int `xml:"gid,attr"`
+}
+
+func TestParseTMXData(t *testing.T) {
+	tests := []struct {
+		name        string
+		encoding    string
+		text        string
+		tiles       tmxGids
+		want        []int
+		wantEncoded string
+		wantErr     bool
+	}{
+		{name: "xml", tiles: tmxGids{{1}, {0}, {2147483649}}, want: []int{1, 0, 2147483649}},
+		{name: "xml empty", tiles: tmxGids{}, want: []int{}},
+		{name: "csv", encoding: "csv", text: "\n1,0,2,\n3,4,5\n", want: []int{1, 0, 2, 3, 4, 5}},
+		{name: "csv flipped gid", encoding: "csv", text: "2147483649", want: []int{2147483649}},
+		{name: "csv invalid gid", encoding: "csv", text: "1,x,2", wantErr: true},
+		{name: "csv negative gid", encoding: "csv", text: "1,-2", wantErr: true},
+		{name: "base64", encoding: "base64", text: "\n   AQAAAA==\n", wantEncoded: "AQAAAA=="},
+		{name: "unsupported encoding", encoding: "hex", text: "01", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := parseTMXData(test.encoding, test.text, test.tiles)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", data)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(data.Tiles, test.want) {
+				t.Errorf("tiles = %v, want %v", data.Tiles, test.want)
+			}
+
+			if data.Encoded != test.wantEncoded {
+				t.Errorf("encoded = %q, want %q", data.Encoded, test.wantEncoded)
+			}
+		})
+	}
+}
+
+func TestDecodeTMX(t *testing.T) {
+	gids := []int{1, 2, 3, 4}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "xml", data: `<data><tile gid="1"/><tile gid="2"/><tile gid="3"/><tile gid="4"/></data>`},
+		{name: "csv", data: "<data encoding=\"csv\">\n1,2,\n3,4\n</data>"},
+		{name: "base64 zlib", data: `<data encoding="base64" compression="zlib">` + encodeGids(t, gids, "zlib") + `</data>`},
+		{name: "base64 gzip", data: `<data encoding="base64" compression="gzip">` + encodeGids(t, gids, "gzip") + `</data>`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.10" orientation="orthogonal" renderorder="right-down" width="2" height="2" tilewidth="32" tileheight="32" infinite="0">
+ <group id="1" name="Group">
+  <layer id="2" name="Meta" width="2" height="2">` + test.data + `</layer>
+ </group>
+ <objectgroup id="3" name="Objects">
+  <object id="1" name="spawn" class="spawn" x="32" y="0" width="32" height="32"/>
+ </objectgroup>
+</map>`
+
+			m, err := decodeTMX([]byte(file))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := m.normalize("maps/test.tmx"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(m.Layers) != 2 || len(m.Layers[0].Layers) != 1 {
+				t.Fatalf("unexpected layers %+v", m.Layers)
+			}
+
+			layer := &m.Layers[0].Layers[0]
+
+			if !reflect.DeepEqual(layer.tiles(), gids) {
+				t.Errorf("tiles = %v, want %v", layer.tiles(), gids)
+			}
+
+			objects := m.Layers[1].Objects
+
+			if len(objects) != 1 || objects[0].Type != "spawn" || objects[0].X != 32 {
+				t.Errorf("objects = %+v", objects)
+			}
+		})
+	}
+}